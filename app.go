@@ -1,37 +1,58 @@
 package main
 
-import (
-	"log"
-	"os"
-
-	"github.com/joho/godotenv"
-)
+import "time"
 
 type App struct {
+	config    Config
 	twitter   TwitterClient
 	ens       ENSClient
 	etherscan EtherscanClient
+	prices    PriceOracle
 	seedUsers TwitterScrapeSeedInstructions
 	users     map[string]TwitterUser
+
+	provenance SeedProvenance
+
+	at *PointInTime // Set for reports at a past block
 }
 
-func BootstrapApp() App {
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatal("Error loading .env file")
-	}
-	bearerToken := os.Getenv("TWITTER_BEARER_TOKEN")
-	twitter := NewTwitterClient(bearerToken)
-	ens := NewENSClient(os.Getenv("INFURA_URL"))
-	etherscan := NewEtherscanClient(os.Getenv("ETHERSCAN_API_KEY"))
+// Set up the clients and load the user pool. Fails if the pool can't be loaded,
+// e.g. on a Twitter error, and leaves it to the command whether to exit or retry.
+func BootstrapApp(config Config) (App, error) {
+	caches := config.Cache
+
+	twitter := NewTwitterClient(config.Providers.TwitterBearerToken)
+	ens := NewENSClient(
+		config.Providers.InfuraUrl,
+		caches.Open(caches.ENSDir),
+		config.Paths.ENSIgnoreList,
+		NewRateLimiter(config.RateLimits.InfuraPerSecond),
+		config.ENS,
+	)
+	etherscan := NewEtherscanClient(
+		config.Providers.EtherscanApiKey,
+		caches.Open(caches.ETHDir),
+		NewRateLimiter(config.RateLimits.EtherscanPerSecond),
+	)
 
-	seed, err := LoadTwitterScrapeSeed()
-	check(err)
+	var seed TwitterScrapeSeedInstructions
+	var userPool []TwitterUser
+	var provenance SeedProvenance
+	var err error
 
-	seed = seed.Inflate(twitter)
-	seed.Persist()
+	if config.Import.Enabled() {
+		userPool, provenance, err = LoadImportedPool(config.Import)
+	} else {
+		seed, userPool, provenance, err = loadSeedPool(config, twitter)
+	}
+
+	if err != nil {
+		return App{}, err
+	}
 
-	userPool := seed.LoadFollowing(twitter)
+	if config.Extract.PinnedTweets {
+		userPool = attachPinnedTweets(twitter, config.Cache.Open(config.Cache.TwitterDir), userPool)
+	}
 
 	userMap := make(map[string]TwitterUser)
 
@@ -39,5 +60,96 @@ func BootstrapApp() App {
 		userMap[user.Id] = user
 	}
 
-	return App{twitter, ens, etherscan, seed, userMap}
+	prices, err := NewPriceOracle(config.Price, etherscan, ens)
+	if err != nil {
+		return App{}, err
+	}
+
+	return App{config, twitter, ens, etherscan, prices, seed, userMap, provenance, nil}, nil
+}
+
+// For the long-running commands: keep retrying every interval until the user pool
+// loads rather than dying on one bad Twitter response
+func BootstrapAppWithRetry(config Config, interval time.Duration) App {
+	for {
+		app, err := BootstrapApp(config)
+		if err == nil {
+			return app
+		}
+
+		logger.Error("Could not load the user pool, retrying in %s: %s", interval, err)
+		time.Sleep(interval)
+	}
+}
+
+func loadSeedPool(config Config, twitter TwitterClient) (TwitterScrapeSeedInstructions, []TwitterUser, SeedProvenance, error) {
+	seed, err := LoadTwitterScrapeSeed(config.Paths.Seed)
+	if err != nil {
+		return seed, nil, nil, err
+	}
+
+	seed, changed := seed.Inflate(twitter)
+	if changed {
+		seed.Persist(config.Paths.Seed)
+	}
+
+	twitterCache := config.Cache.Open(config.Cache.TwitterDir)
+	userPool, provenance, err := seed.LoadUserPool(twitter, twitterCache)
+	if err != nil {
+		return seed, nil, nil, err
+	}
+
+	// Stale ids otherwise make a seed silently drop out of the pool
+	seed, changed = seed.Reinflate(twitter, seed.Missing(provenance))
+	if changed {
+		seed.Persist(config.Paths.Seed)
+
+		userPool, provenance, err = seed.LoadUserPool(twitter, twitterCache)
+		if err != nil {
+			return seed, nil, nil, err
+		}
+	}
+
+	if config.Crawl.Depth > 1 {
+		userPool, err = Crawl(twitter, twitterCache, config.Crawl, seed, userPool, provenance)
+		if err != nil {
+			return seed, nil, nil, err
+		}
+	}
+
+	return seed, userPool, provenance, nil
+}
+
+func attachPinnedTweets(twitter TwitterClient, cache Cache, users []TwitterUser) []TwitterUser {
+	tweets, err := twitter.CachedPinnedTweets(users, cache)
+	if err != nil {
+		// Pinned tweets are a bonus, so carry on with whatever we managed to fetch
+		logger.Warn("Could not fetch all pinned tweets: %s", err)
+	}
+
+	for index, user := range users {
+		if tweet, isPresent := tweets[user.PinnedTweetId]; isPresent {
+			users[index].PinnedTweet = &tweet
+		}
+	}
+
+	return users
+}
+
+// A copy of the app which reports balances and prices as of a past block
+func (app App) AtPointInTime(at PointInTime) App {
+	historical := app
+	historical.at = &at
+
+	return historical
+}
+
+// A copy of the app whose ENS and Etherscan clients skip the on-disk cache, for
+// when we need current resolutions and balances rather than whatever we saw first.
+func (app App) Uncached() App {
+	uncached := app
+	uncached.ens.cache = NamedCache(NewMemoryCache(), cacheName(app.ens.cache))
+	uncached.etherscan.cache = NamedCache(NewMemoryCache(), cacheName(app.etherscan.cache))
+
+	return uncached
 }
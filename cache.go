@@ -6,16 +6,88 @@ import (
 	"path"
 )
 
-type FileSystemCache struct {
-	dir string
-}
-
 type Cacheable interface {
 	CacheKey() string
 }
 
+// A Cache is a key/value store for API responses and other expensive lookups. Keys
+// come from the Cacheable subject and values are opaque byte slices.
+type Cache interface {
+	IsCached(object Cacheable) bool
+	ReadCache(object Cacheable) []byte
+	WriteCache(object Cacheable, serialized []byte)
+}
+
+type CacheBackend string
+
+const (
+	FileSystemCacheBackend CacheBackend = "filesystem"
+	BoltCacheBackend       CacheBackend = "bolt"
+	MemoryCacheBackend     CacheBackend = "memory"
+)
+
+// Selects which Cache implementation backs each namespace. Namespaces are the
+// directories we historically cached into (e.g. "data/ens") so the filesystem
+// backend stays compatible with existing caches on disk.
+type CacheConfig struct {
+	Backend    CacheBackend `yaml:"backend"`
+	BoltPath   string       `yaml:"bolt_path"`
+	TwitterDir string       `yaml:"twitter_dir"`
+	ENSDir     string       `yaml:"ens_dir"`
+	ETHDir     string       `yaml:"eth_dir"`
+}
+
+func (config CacheConfig) Open(namespace string) Cache {
+	switch config.Backend {
+	case BoltCacheBackend:
+		return NamedCache(NewBoltCache(config.BoltPath, namespace), config.label(namespace))
+	case MemoryCacheBackend:
+		return NamedCache(NewMemoryCache(), config.label(namespace))
+	default:
+		return NamedCache(NewFileSystemCache(namespace), config.label(namespace))
+	}
+}
+
+// Short names for the namespaces in metrics, since the directories may be shared
+// or renamed
+func (config CacheConfig) label(namespace string) string {
+	switch namespace {
+	case config.TwitterDir:
+		return "twitter"
+	case config.ENSDir:
+		return "ens"
+	case config.ETHDir:
+		return "eth"
+	default:
+		return namespace
+	}
+}
+
+// A Cache labelled with the namespace it was opened for, so cache metrics can be
+// told apart
+type namedCache struct {
+	Cache
+	name string
+}
+
+func NamedCache(cache Cache, name string) Cache {
+	return namedCache{cache, name}
+}
+
+func cacheName(cache Cache) string {
+	if named, ok := cache.(namedCache); ok {
+		return named.name
+	}
+
+	return "unnamed"
+}
+
 // Caching functionality concerned with the filesystem
 
+type FileSystemCache struct {
+	dir string
+}
+
 func NewFileSystemCache(dir string) FileSystemCache {
 	cacheDir, err := JoinProjectPath(dir)
 
@@ -58,12 +130,15 @@ type JSONSerializable interface{}
 type WithRawCacheCallback func() ([]byte, error)
 type WithJSONCacheCallback[ResultType JSONSerializable] func() (ResultType, error)
 
-func (cache FileSystemCache) WithRawCache(subject Cacheable, callback WithRawCacheCallback) ([]byte, error) {
+func WithRawCache(cache Cache, subject Cacheable, callback WithRawCacheCallback) ([]byte, error) {
 	if cache.IsCached(subject) {
 		logger.Debug("Cache hit (%s)", subject.CacheKey())
+		cacheLookups.Inc(cacheName(cache), "hit")
 		return cache.ReadCache(subject), nil
 	}
 
+	cacheLookups.Inc(cacheName(cache), "miss")
+
 	liveResult, err := callback()
 
 	if err != nil {
@@ -74,17 +149,20 @@ func (cache FileSystemCache) WithRawCache(subject Cacheable, callback WithRawCac
 	return liveResult, nil
 }
 
-func WithJSONCache[Deserialized JSONSerializable](cache FileSystemCache, subject Cacheable, callback WithJSONCacheCallback[Deserialized]) (Deserialized, error) {
+func WithJSONCache[Deserialized JSONSerializable](cache Cache, subject Cacheable, callback WithJSONCacheCallback[Deserialized]) (Deserialized, error) {
 	var deserialized Deserialized
 
 	if cache.IsCached(subject) {
 		logger.Debug("Cache hit (%s)", subject.CacheKey())
+		cacheLookups.Inc(cacheName(cache), "hit")
 
 		data := cache.ReadCache(subject)
 		json.Unmarshal(data, &deserialized)
 		return deserialized, nil
 	}
 
+	cacheLookups.Inc(cacheName(cache), "miss")
+
 	deserialized, err := callback()
 
 	if err != nil {
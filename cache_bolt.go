@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Caching functionality backed by a single bbolt file. Each namespace gets its own
+// bucket so that the whole cache can be copied around as one file.
+
+type BoltCache struct {
+	db     *bolt.DB
+	bucket []byte
+}
+
+var (
+	boltDatabases     = map[string]*bolt.DB{}
+	boltDatabasesLock sync.Mutex
+)
+
+// How long to wait for another process to let go of a bbolt file before giving up
+const BoltLockTimeout = 5 * time.Second
+
+// bbolt locks the file, so another process using it makes this wait up to
+// BoltLockTimeout and then fail with an error naming the file, rather than hang
+func openBolt(dbPath string, readOnly bool) (*bolt.DB, error) {
+	db, err := bolt.Open(dbPath, 0644, &bolt.Options{Timeout: BoltLockTimeout, ReadOnly: readOnly})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return nil, fmt.Errorf("%s is in use by another process", dbPath)
+	}
+
+	return db, err
+}
+
+// bbolt holds an exclusive lock on the file, so every namespace has to share the
+// same handle rather than opening the file again.
+func openBoltDatabase(relativePath string) (*bolt.DB, error) {
+	boltDatabasesLock.Lock()
+	defer boltDatabasesLock.Unlock()
+
+	dbPath, err := JoinProjectPath(relativePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if db, isPresent := boltDatabases[dbPath]; isPresent {
+		return db, nil
+	}
+
+	if err := EnsureDirExists(path.Dir(dbPath)); err != nil {
+		return nil, err
+	}
+
+	db, err := openBolt(dbPath, false)
+	if err != nil {
+		return nil, err
+	}
+
+	boltDatabases[dbPath] = db
+
+	return db, nil
+}
+
+func NewBoltCache(dbPath string, namespace string) BoltCache {
+	db, err := openBoltDatabase(dbPath)
+	check(err)
+
+	bucket := []byte(namespace)
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucket)
+		return err
+	})
+	check(err)
+
+	return BoltCache{db, bucket}
+}
+
+func (cache BoltCache) IsCached(object Cacheable) bool {
+	return cache.ReadCache(object) != nil
+}
+
+func (cache BoltCache) WriteCache(object Cacheable, serialized []byte) {
+	err := cache.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(cache.bucket).Put([]byte(object.CacheKey()), serialized)
+	})
+	check(err)
+}
+
+func (cache BoltCache) ReadCache(object Cacheable) []byte {
+	var buffer []byte
+
+	err := cache.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(cache.bucket).Get([]byte(object.CacheKey()))
+
+		// Values returned by bbolt are only valid for the life of the transaction
+		if value != nil {
+			buffer = append([]byte{}, value...)
+		}
+
+		return nil
+	})
+	check(err)
+
+	return buffer
+}
@@ -0,0 +1,37 @@
+package main
+
+import "sync"
+
+// Caching functionality that never touches disk. Useful for tests and for one-off
+// runs where we deliberately want live data.
+
+type MemoryCache struct {
+	lock    *sync.RWMutex
+	entries map[string][]byte
+}
+
+func NewMemoryCache() MemoryCache {
+	return MemoryCache{&sync.RWMutex{}, map[string][]byte{}}
+}
+
+func (cache MemoryCache) IsCached(object Cacheable) bool {
+	cache.lock.RLock()
+	defer cache.lock.RUnlock()
+
+	_, isPresent := cache.entries[object.CacheKey()]
+	return isPresent
+}
+
+func (cache MemoryCache) WriteCache(object Cacheable, serialized []byte) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	cache.entries[object.CacheKey()] = serialized
+}
+
+func (cache MemoryCache) ReadCache(object Cacheable) []byte {
+	cache.lock.RLock()
+	defer cache.lock.RUnlock()
+
+	return cache.entries[object.CacheKey()]
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Bios often mention names that belong to someone else: "building at uniswap.eth",
+// "ex-coinbase.eth", "thanks to vitalik.eth". Ownership scores how likely it is that
+// the user is claiming a name as their own, from 0 (certainly a mention) to 1
+// (confirmed by the name's own com.twitter text record).
+type Ownership struct {
+	Score   float64  `json:"score"`
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// Names scoring below this are treated as mentions by the mention policy
+const MentionThreshold = 0.5
+
+func (ownership *Ownership) isLikelyMention() bool {
+	return ownership != nil && ownership.Score < MentionThreshold
+}
+
+// How much each place in a profile suggests ownership before looking at context
+var sourceBaseScores = map[DomainSource]float64{
+	HandleSource:      0.95,
+	DisplayNameSource: 0.9,
+	URLSource:         0.7,
+	BioSource:         0.6,
+	PinnedTweetSource: 0.5,
+}
+
+// Words right before a name that suggest the user is talking about it rather than
+// claiming it
+var mentionCues = map[string]bool{
+	"at": true, "ex": true, "prev": true, "previously": true, "formerly": true, "former": true,
+	"building": true, "build": true, "built": true, "working": true, "work": true, "works": true,
+	"contributor": true, "contributing": true, "core": true, "dev": true, "developer": true,
+	"engineer": true, "team": true, "member": true, "by": true, "from": true, "thanks": true,
+	"thx": true, "via": true, "of": true, "for": true, "with": true, "cc": true, "founder": true,
+	"cofounder": true, "co-founder": true, "advisor": true, "investor": true, "backed": true,
+	"partner": true, "ceo": true, "cto": true, "head": true, "lead": true, "powered": true,
+	"supporting": true, "love": true, "loves": true, "fan": true, "and": true,
+}
+
+// Words right before a name that suggest the user is claiming it
+var ownershipCues = map[string]bool{
+	"me": true, "my": true, "mine": true, "i'm": true, "im": true, "aka": true, "ens": true,
+	"wallet": true, "address": true, "addr": true, "gm": true,
+}
+
+// A name which is confirmed by its own text record skips the heuristics entirely
+func ClassifyOwnership(user TwitterUser, domain ENSDomain, locations []DomainLocation) Ownership {
+	if len(locations) == 0 {
+		return Ownership{Score: 0}
+	}
+
+	best := Ownership{Score: math.Inf(-1)}
+
+	for _, location := range locations {
+		if location.Source == TextRecordSource {
+			return Ownership{1, []string{"com.twitter text record points to @" + user.Username}}
+		}
+
+		candidate := classifyLocation(user, domain, location)
+		if candidate.Score > best.Score {
+			best = candidate
+		}
+	}
+
+	if matchesIdentity(user, domain) {
+		best.Score += 0.2
+		best.Reasons = append(best.Reasons, "matches handle or display name")
+	}
+
+	best.Score = math.Max(0, math.Min(1, best.Score))
+
+	return best
+}
+
+func classifyLocation(user TwitterUser, domain ENSDomain, location DomainLocation) Ownership {
+	ownership := Ownership{sourceBaseScores[location.Source], []string{"in " + string(location.Source)}}
+
+	if strings.HasPrefix(string(domain), "ex-") {
+		ownership.Score -= 0.4
+		ownership.Reasons = append(ownership.Reasons, "former affiliation")
+	}
+
+	text := []rune(fieldText(user, location.Source))
+	if location.Offset < 0 || location.Offset > len(text) {
+		return ownership
+	}
+
+	before := text[:location.Offset]
+
+	if location.Offset > 0 && before[len(before)-1] == '@' {
+		ownership.Score -= 0.2
+		ownership.Reasons = append(ownership.Reasons, "@mention")
+	}
+
+	words := strings.FieldsFunc(strings.ToLower(string(before)), func(character rune) bool {
+		return !unicode.IsLetter(character) && !unicode.IsDigit(character) && character != '\'' && character != '-'
+	})
+
+	switch {
+	case len(words) == 0:
+		ownership.Score += 0.2
+		ownership.Reasons = append(ownership.Reasons, "starts the "+string(location.Source))
+	case ownershipCues[words[len(words)-1]]:
+		ownership.Score += 0.3
+		ownership.Reasons = append(ownership.Reasons, fmt.Sprintf("after %q", words[len(words)-1]))
+	case mentionCues[words[len(words)-1]]:
+		ownership.Score -= 0.4
+		ownership.Reasons = append(ownership.Reasons, fmt.Sprintf("after %q", words[len(words)-1]))
+	case len(text) > 40 && float64(location.Offset) > 0.6*float64(len(text)):
+		ownership.Score -= 0.1
+		ownership.Reasons = append(ownership.Reasons, "late in the "+string(location.Source))
+	}
+
+	return ownership
+}
+
+func fieldText(user TwitterUser, source DomainSource) string {
+	switch source {
+	case HandleSource:
+		return user.Username
+	case DisplayNameSource:
+		return user.Name
+	case BioSource:
+		return user.Description
+	case PinnedTweetSource:
+		if user.PinnedTweet != nil {
+			return user.PinnedTweet.Text
+		}
+	}
+
+	return ""
+}
+
+// Whether the name's first label looks like the user's handle or display name,
+// ignoring case and punctuation, e.g. vitalik.eth for @VitalikButerin
+func matchesIdentity(user TwitterUser, domain ENSDomain) bool {
+	label := identityKey(strings.Split(string(domain), ".")[0])
+	if len([]rune(label)) < 3 {
+		return false
+	}
+
+	for _, identity := range []string{user.Username, user.Name} {
+		key := identityKey(identity)
+
+		if strings.Contains(key, label) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func identityKey(text string) string {
+	return strings.Map(func(character rune) rune {
+		if unicode.IsLetter(character) || unicode.IsDigit(character) {
+			return unicode.ToLower(character)
+		}
+
+		return -1
+	}, text)
+}
+
+// What to do with names that are likely mentions of someone else
+type MentionPolicy string
+
+const (
+	IncludeMentions    MentionPolicy = "include"
+	DownweightMentions MentionPolicy = "downweight"
+	ExcludeMentions    MentionPolicy = "exclude"
+)
+
+// Drop or discount likely mentions according to the output config, re-sorting the
+// leaderboard by the resulting balances
+func ApplyMentionPolicy(sortedResults []UserENSReport, output OutputConfig) []UserENSReport {
+	if output.Mentions == IncludeMentions || output.Mentions == "" {
+		return sortedResults
+	}
+
+	adjusted := []UserENSReport{}
+
+	for _, userReport := range sortedResults {
+		reports := []ENSReport{}
+
+		for _, report := range userReport.ensReportList.reports {
+			if !report.ownership.isLikelyMention() {
+				reports = append(reports, report)
+				continue
+			}
+
+			if output.Mentions == ExcludeMentions {
+				continue
+			}
+
+			if report.balance != nil {
+				discounted := new(big.Rat).Mul(new(big.Rat).SetInt(report.balance), floatToDecimal(output.MentionWeight))
+				report.balance = new(big.Int).Quo(discounted.Num(), discounted.Denom()) // Fractions of a wei don't matter
+			}
+
+			reports = append(reports, report)
+		}
+
+		if len(reports) == 0 {
+			continue
+		}
+
+		userReport.ensReportList = ENSReportList{reports}
+		adjusted = append(adjusted, userReport)
+	}
+
+	sort.SliceStable(adjusted, func(i, j int) bool {
+		return hasMoreETH(adjusted[i], adjusted[j])
+	})
+
+	return adjusted
+}
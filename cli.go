@@ -0,0 +1,410 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+type Command struct {
+	name        string
+	arguments   string
+	description string
+	run         func(args []string)
+}
+
+var commands []Command
+
+func init() {
+	commands = []Command{
+		{"report", "[leaderboard flags] [--at-block N | --at-date YYYY-MM-DD]", "Build the leaderboard and store it as a new run (default)", reportCommand},
+		{"runs", "", "List stored runs", runsCommand},
+		{"show", "[leaderboard flags] <run id|latest>", "Print the leaderboard from a stored run", showCommand},
+		{"history", "<username>", "Show a user's balance across stored runs", historyCommand},
+		{"conflicts", "[run id|latest]", "List addresses and names claimed by more than one account", conflictsCommand},
+		{"diff", "<from run> <to run>", "Compare two stored runs", diffCommand},
+		{"watch", "[flags]", "Re-run on a schedule and emit alerts", watchCommand},
+		{"serve", "[--addr :8080] [--refresh 15m]", "Serve stored runs as a JSON API and a leaderboard page", serveCommand},
+		{"seed", "<subcommand> [arguments]", "Manage the seed users, lists, and usernames that make up the pool", seedCommand},
+		{"extract", "<text>", "Show the ENS names found in some text", extractCommand},
+		{"config", "check", "Validate the config file and environment", configCommand},
+		{"help", "", "Show this message", helpCommand},
+	}
+}
+
+func RunCommand(args []string) {
+	// Goes to stderr so it never ends up in JSON output
+	defer WriteMetricsSummary(os.Stderr)
+
+	if len(args) == 0 {
+		reportCommand(args)
+		return
+	}
+
+	for _, command := range commands {
+		if command.name == args[0] {
+			command.run(args[1:])
+			return
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", args[0])
+	printUsage()
+	exit(1)
+}
+
+// os.Exit skips deferred calls, so print the metrics summary RunCommand would
+// have printed on the way out
+func exit(code int) {
+	WriteMetricsSummary(os.Stderr)
+	os.Exit(code)
+}
+
+func printUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: flex_eth <command> [arguments]\n\nCommands:\n")
+
+	width := 0
+	for _, command := range commands {
+		if length := len(command.name) + len(command.arguments) + 1; length > width {
+			width = length
+		}
+	}
+
+	for _, command := range commands {
+		usage := strings.TrimSpace(command.name + " " + command.arguments)
+		fmt.Fprintf(os.Stderr, "  %-*s   %s\n", width, usage, command.description)
+	}
+}
+
+func requireArgs(args []string, count int, usage string) {
+	if len(args) < count {
+		fmt.Fprintf(os.Stderr, "Usage: flex_eth %s\n", usage)
+		exit(1)
+	}
+}
+
+func helpCommand(args []string) {
+	printUsage()
+}
+
+func reportCommand(args []string) {
+	flags := flag.NewFlagSet("report", flag.ExitOnError)
+	leaderboardFlags := NewLeaderboardFlags(flags)
+	atBlock := flags.Uint64("at-block", 0, "Report balances and the ETH price as of this block")
+	atDate := flags.String("at-date", "", "Report balances and the ETH price as of the end of this day (YYYY-MM-DD)")
+	flags.Parse(args)
+
+	if *atBlock > 0 && *atDate != "" {
+		fmt.Fprintf(os.Stderr, "Use either --at-block or --at-date, not both\n")
+		exit(1)
+	}
+
+	config := mustLoadConfig(true, leaderboardFlags.Apply)
+
+	app, err := BootstrapApp(config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		exit(1)
+	}
+
+	logger.Debug("Total users in pool: %d\n\n", len(app.users))
+
+	if *atBlock > 0 || *atDate != "" {
+		at, err := app.ResolvePointInTime(*atBlock, *atDate)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			exit(1)
+		}
+
+		app = app.AtPointInTime(at)
+
+		if config.Output.Format == TableOutput {
+			fmt.Printf("Balances at block %d (%s)\n\n", at.Block, at.Date.Format(DateFormat))
+		}
+	} else {
+		// Resolutions and balances are cached forever, so a stored run has to fetch
+		// them fresh like watch and serve do, or every run would repeat the first one
+		app = app.Uncached()
+	}
+
+	snapshot, err := app.BuildSnapshot()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		exit(1)
+	}
+
+	printSnapshot(config, snapshot)
+
+	// Past-block reports would otherwise become the "latest" run that diff and
+	// watch compare against
+	if snapshot.PointInTime {
+		return
+	}
+
+	if err := NewRunStore(config.Paths.Runs).Save(snapshot); err != nil {
+		fmt.Fprintf(os.Stderr, "Could not store run %s: %s\n", snapshot.Id, err)
+		exit(1)
+	}
+
+	logger.Info("\nStored run %s", snapshot.Id)
+}
+
+func watchCommand(args []string) {
+	flags := flag.NewFlagSet("watch", flag.ExitOnError)
+	interval := flags.Duration("interval", 15*time.Minute, "How long to wait between runs")
+	balanceChange := flags.Float64("balance-change", 0, "Alert when a user's balance moves by at least this much ETH (0 disables)")
+	addressChanges := flags.Bool("address-changes", true, "Alert when a domain starts resolving to a different address")
+	top := flags.Int("top", 0, "Alert when a user enters the top N of the leaderboard (0 disables)")
+	alertFile := flags.String("alert-file", "", "Append alerts as JSON lines to this file")
+	webhook := flags.String("webhook", "", "POST alerts as JSON to this URL")
+	quiet := flags.Bool("quiet", false, "Don't print alerts to stdout")
+	metricsAddr := flags.String("metrics-addr", "", "Serve Prometheus metrics at /metrics on this address, e.g. :9090")
+	flags.Parse(args)
+
+	rules := []AlertRule{}
+	if *balanceChange > 0 {
+		rules = append(rules, BalanceMoveRule{ethToWei(floatToDecimal(*balanceChange))})
+	}
+	if *addressChanges {
+		rules = append(rules, AddressChangeRule{})
+	}
+	if *top > 0 {
+		rules = append(rules, EnteredTopRule{*top})
+	}
+
+	sinks := []AlertSink{}
+	if !*quiet {
+		sinks = append(sinks, StdoutAlertSink{})
+	}
+	if *alertFile != "" {
+		sinks = append(sinks, FileAlertSink{*alertFile})
+	}
+	if *webhook != "" {
+		sinks = append(sinks, WebhookAlertSink{*webhook})
+	}
+
+	config := mustLoadConfig(true)
+
+	if *metricsAddr != "" {
+		ServeMetrics(*metricsAddr)
+	}
+
+	watcher := Watcher{BootstrapAppWithRetry(config, *interval), NewRunStore(config.Paths.Runs), rules, sinks, *interval}
+	watcher.Run()
+}
+
+func serveCommand(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := flags.String("addr", ":8080", "Address to listen on")
+	refresh := flags.Duration("refresh", 0, "Build and store a new run on this interval (0 only serves stored runs)")
+	flags.Parse(args)
+
+	// Refreshing needs API credentials; serving stored runs doesn't
+	config := mustLoadConfig(*refresh > 0)
+
+	var refresher *Refresher
+	if *refresh > 0 {
+		refresher = &Refresher{config, *refresh}
+	}
+
+	server := NewServer(config, NewRunStore(config.Paths.Runs), refresher)
+	check(server.ListenAndServe(*addr))
+}
+
+func runsCommand(args []string) {
+	config := mustLoadConfig(false)
+
+	snapshots, err := NewRunStore(config.Paths.Runs).List()
+	check(err)
+
+	PrintRunList(snapshots)
+}
+
+func showCommand(args []string) {
+	flags := flag.NewFlagSet("show", flag.ExitOnError)
+	leaderboardFlags := NewLeaderboardFlags(flags)
+	flags.Parse(args)
+
+	requireArgs(flags.Args(), 1, "show [leaderboard flags] <run id|latest>")
+
+	config := mustLoadConfig(false, leaderboardFlags.Apply)
+
+	snapshot, err := loadRun(NewRunStore(config.Paths.Runs), flags.Arg(0))
+	check(err)
+
+	if config.Output.Format == TableOutput {
+		fmt.Printf("Run %s (block %d)\n\n", snapshot.Id, snapshot.BlockNumber)
+	}
+
+	printSnapshot(config, snapshot)
+}
+
+func historyCommand(args []string) {
+	requireArgs(args, 1, "history <username>")
+
+	config := mustLoadConfig(false)
+
+	snapshots, err := NewRunStore(config.Paths.Runs).List()
+	check(err)
+
+	PrintBalanceHistory(args[0], snapshots)
+}
+
+func conflictsCommand(args []string) {
+	config := mustLoadConfig(false)
+
+	id := "latest"
+	if len(args) > 0 {
+		id = args[0]
+	}
+
+	snapshot, err := loadRun(NewRunStore(config.Paths.Runs), id)
+	check(err)
+
+	conflicts := FindConflicts(snapshot.Reports())
+
+	if config.Output.Format == JSONOutput {
+		PrintJSON(conflicts)
+		return
+	}
+
+	PrintConflicts(conflicts)
+}
+
+func diffCommand(args []string) {
+	requireArgs(args, 2, "diff <from run> <to run>")
+
+	config := mustLoadConfig(false)
+	store := NewRunStore(config.Paths.Runs)
+
+	from, err := loadRun(store, args[0])
+	check(err)
+
+	to, err := loadRun(store, args[1])
+	check(err)
+
+	diff := DiffRuns(config, from, to)
+
+	if config.Output.Format == JSONOutput {
+		PrintJSON(diff)
+		return
+	}
+
+	PrintRunDiff(diff)
+}
+
+func loadRun(store RunStore, id string) (RunSnapshot, error) {
+	if id == "latest" {
+		return store.Latest()
+	}
+
+	return store.Get(id)
+}
+
+func configCommand(args []string) {
+	requireArgs(args, 1, "config check")
+
+	if args[0] != "check" {
+		fmt.Fprintf(os.Stderr, "Unknown config subcommand %q (expected check)\n", args[0])
+		exit(1)
+	}
+
+	config, err := LoadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		exit(1)
+	}
+
+	if config.path == "" {
+		fmt.Printf("No config file found, using defaults and environment variables\n")
+	} else {
+		fmt.Printf("Loaded config from %s\n", config.path)
+	}
+
+	problems := append(config.Validate(), config.ValidateProviders()...)
+
+	if len(problems) == 0 {
+		fmt.Printf("Config OK\n")
+		return
+	}
+
+	fmt.Printf("\nFound %d problem(s):\n", len(problems))
+	for _, problem := range problems {
+		fmt.Printf("  - %s\n", problem)
+	}
+
+	exit(1)
+}
+
+// Load and validate the config, exiting with every problem listed if it is unusable.
+// Offline commands pass needsProviders=false so they work without API credentials.
+// Overrides (usually from command line flags) are applied before validation.
+func mustLoadConfig(needsProviders bool, overrides ...func(config *Config)) Config {
+	config, err := LoadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		exit(1)
+	}
+
+	for _, override := range overrides {
+		override(&config)
+	}
+
+	problems := config.Validate()
+	if needsProviders {
+		problems = append(problems, config.ValidateProviders()...)
+	}
+
+	if len(problems) > 0 {
+		fmt.Fprintf(os.Stderr, "Invalid configuration:\n")
+		for _, problem := range problems {
+			fmt.Fprintf(os.Stderr, "  - %s\n", problem)
+		}
+		fmt.Fprintf(os.Stderr, "\nRun `flex_eth config check` for details.\n")
+		exit(1)
+	}
+
+	ConfigureExtractor(config.Extract)
+
+	return config
+}
+
+// The leaderboard for a run as configured: excluded mentions dropped, shared
+// balances attributed, downweighted mentions discounted, then filtered and sorted
+func leaderboardReports(config Config, snapshot RunSnapshot) []UserENSReport {
+	reports := snapshot.Reports()
+
+	// An excluded mention mustn't take a share of its owner's balance, while a
+	// downweighted one is discounted from its share of the full balance
+	if config.Output.Mentions == ExcludeMentions {
+		reports = ApplyMentionPolicy(reports, config.Output)
+	}
+
+	reports = AttributeSharedBalances(reports, config.Output.SharedBalances)
+
+	if config.Output.Mentions == DownweightMentions {
+		reports = ApplyMentionPolicy(reports, config.Output)
+	}
+	reports = WeightByProximity(reports, config.Output.ProximityWeight)
+
+	return ApplyLeaderboardOptions(reports, LeaderboardOptions(config, snapshot.Price())...)
+}
+
+func printSnapshot(config Config, snapshot RunSnapshot) {
+	reports := leaderboardReports(config, snapshot)
+
+	if config.Output.Format == JSONOutput {
+		filtered := snapshot
+		filtered.Users = NewSnapshotUsers(reports)
+		PrintJSON(filtered)
+		return
+	}
+
+	price, err := config.Price.Currency.Convert(snapshot.Price(), config.Price.FXRates)
+	check(err)
+
+	PrintLeaderboard(reports, price, config.Price.Currency)
+	PrintPriceSource(snapshot, price, config.Price.Currency)
+}
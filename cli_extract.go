@@ -0,0 +1,26 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+func extractCommand(args []string) {
+	flags := flag.NewFlagSet("extract", flag.ExitOnError)
+	flags.Parse(args)
+
+	mustLoadConfig(false)
+
+	requireArgs(flags.Args(), 1, "extract <text>")
+
+	text := strings.Join(flags.Args(), " ")
+
+	for _, match := range scanENSNames([]rune(text), ensTLDs) {
+		fmt.Printf("%s (offset %d)\n", match.Domain, match.Offset)
+	}
+
+	for _, address := range findETHAddresses(text) {
+		fmt.Printf("%s\n", address)
+	}
+}
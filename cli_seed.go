@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+const seedUsage = "seed <list|add|remove|enable|disable|sources|refresh|add-list|remove-list|include|exclude> [arguments]"
+
+func seedCommand(args []string) {
+	requireArgs(args, 1, seedUsage)
+
+	subcommand, args := args[0], args[1:]
+
+	switch subcommand {
+	case "list":
+		seedListCommand()
+	case "add":
+		requireArgs(args, 1, "seed add <username>")
+		seedAddCommand(args[0])
+	case "remove":
+		requireArgs(args, 1, "seed remove <username>")
+		updateSeed(func(seed TwitterScrapeSeedInstructions) (TwitterScrapeSeedInstructions, error) {
+			return seed.Remove(args[0])
+		})
+	case "enable", "disable":
+		requireArgs(args, 1, fmt.Sprintf("seed %s <username>", subcommand))
+		updateSeed(func(seed TwitterScrapeSeedInstructions) (TwitterScrapeSeedInstructions, error) {
+			return seed.SetEnabled(args[0], subcommand == "enable")
+		})
+	case "sources":
+		requireArgs(args, 2, "seed sources <username> <following,followers>")
+		sources := []SeedSource{}
+		for _, source := range strings.Split(args[1], ",") {
+			sources = append(sources, SeedSource(strings.TrimSpace(source)))
+		}
+		updateSeed(func(seed TwitterScrapeSeedInstructions) (TwitterScrapeSeedInstructions, error) {
+			return seed.SetSources(args[0], sources)
+		})
+	case "refresh":
+		seedRefreshCommand()
+	case "add-list":
+		requireArgs(args, 1, "seed add-list <list id> [name]")
+		list := TwitterScrapeSeedList{Id: args[0], Enabled: true}
+		if len(args) > 1 {
+			list.Name = args[1]
+		}
+		updateSeed(func(seed TwitterScrapeSeedInstructions) (TwitterScrapeSeedInstructions, error) {
+			return seed.AddList(list)
+		})
+	case "remove-list":
+		requireArgs(args, 1, "seed remove-list <list id>")
+		updateSeed(func(seed TwitterScrapeSeedInstructions) (TwitterScrapeSeedInstructions, error) {
+			return seed.RemoveList(args[0])
+		})
+	case "include":
+		requireArgs(args, 1, "seed include <username>")
+		updateSeed(func(seed TwitterScrapeSeedInstructions) (TwitterScrapeSeedInstructions, error) {
+			return seed.Include(strings.TrimPrefix(args[0], "@"))
+		})
+	case "exclude":
+		requireArgs(args, 1, "seed exclude <username>")
+		updateSeed(func(seed TwitterScrapeSeedInstructions) (TwitterScrapeSeedInstructions, error) {
+			return seed.Exclude(strings.TrimPrefix(args[0], "@"))
+		})
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown seed subcommand %q\n\nUsage: flex_eth %s\n", subcommand, seedUsage)
+		exit(1)
+	}
+}
+
+func seedListCommand() {
+	config := mustLoadConfig(false)
+
+	seed, err := LoadTwitterScrapeSeed(config.Paths.Seed)
+	check(err)
+
+	// Follow counts come from the most recent run, if there is one
+	followCounts := map[string]int{}
+	if latest, err := NewRunStore(config.Paths.Runs).Latest(); err == nil {
+		followCounts = latest.SeedFollows
+	}
+
+	heading := fmt.Sprintf("| %-16s | %-20s | %-8s | %-19s | %17s |\n", "Seed", "Id", "Enabled", "Sources", "Accounts last run")
+	fmt.Printf(heading)
+	fmt.Printf("%s\n", strings.Repeat("-", len(heading)))
+
+	for _, user := range seed.Users {
+		id := "-"
+		if user.Id != nil {
+			id = *user.Id
+		}
+
+		sources := []string{}
+		for _, source := range user.sources() {
+			sources = append(sources, string(source))
+		}
+
+		fmt.Printf(
+			"| %-16s | %-20s | %-8t | %-19s | %17s |\n",
+			user.Username, id, user.Enabled, strings.Join(sources, ","), displayCount(followCounts, user.Username),
+		)
+	}
+
+	for _, list := range seed.Lists {
+		fmt.Printf(
+			"| %-16s | %-20s | %-8t | %-19s | %17s |\n",
+			list.label(), list.Id, list.Enabled, "members", displayCount(followCounts, list.label()),
+		)
+	}
+
+	if len(seed.Usernames) > 0 {
+		fmt.Printf(
+			"| %-16s | %-20s | %-8t | %-19s | %17s |\n",
+			ExplicitUsernamesLabel, "-", true, strings.Join(seed.Usernames, ","), displayCount(followCounts, ExplicitUsernamesLabel),
+		)
+	}
+}
+
+func displayCount(counts map[string]int, key string) string {
+	if count, isPresent := counts[key]; isPresent {
+		return fmt.Sprintf("%d", count)
+	}
+
+	return "-"
+}
+
+// New seeds are looked up right away when Twitter credentials are available.
+// Otherwise the id is filled in by Inflate at the start of the next run.
+func seedAddCommand(username string) {
+	config := mustLoadConfig(false)
+	username = strings.TrimPrefix(username, "@")
+
+	user := TwitterScrapeSeedUser{Username: username, Enabled: true}
+
+	if config.Providers.TwitterBearerToken != "" {
+		result, err := NewTwitterClient(config.Providers.TwitterBearerToken).LookupUsers([]string{username})
+		check(err)
+
+		if len(result.Data) == 0 {
+			fmt.Fprintf(os.Stderr, "Could not find a Twitter account named %s\n", username)
+			exit(1)
+		}
+
+		user.Username = result.Data[0].Username
+		user.Id = &result.Data[0].Id
+	}
+
+	updateSeed(func(seed TwitterScrapeSeedInstructions) (TwitterScrapeSeedInstructions, error) {
+		return seed.Add(user)
+	})
+
+	fmt.Printf("Added %s\n", user.label())
+}
+
+func seedRefreshCommand() {
+	config := mustLoadConfig(true)
+
+	seed, err := LoadTwitterScrapeSeed(config.Paths.Seed)
+	check(err)
+
+	seed, changed := seed.Refresh(NewTwitterClient(config.Providers.TwitterBearerToken))
+
+	if changed {
+		seed.Persist(config.Paths.Seed)
+	} else {
+		fmt.Printf("All seed users are up to date\n")
+	}
+}
+
+func updateSeed(update func(TwitterScrapeSeedInstructions) (TwitterScrapeSeedInstructions, error)) {
+	config := mustLoadConfig(false)
+
+	seed, err := LoadTwitterScrapeSeed(config.Paths.Seed)
+	check(err)
+
+	seed, err = update(seed)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		exit(1)
+	}
+
+	seed.Persist(config.Paths.Seed)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// alice owns uni.eth and bob mentions it, so both claim the same address
+func sharedMentionSnapshot() RunSnapshot {
+	tenETH := "10000000000000000000"
+
+	snapshot := testSnapshot(
+		"run",
+		testUser{"1", "alice", []testHolding{{"uni.eth", aliceAddress, tenETH}}},
+		testUser{"2", "bob", []testHolding{{"uni.eth", aliceAddress, tenETH}}},
+	)
+	snapshot.Users[0].Domains[0].Ownership = &Ownership{Score: 1}
+	snapshot.Users[1].Domains[0].Ownership = &Ownership{Score: 0.2}
+
+	return snapshot
+}
+
+func leaderboardRows(config Config, snapshot RunSnapshot) string {
+	rows := []string{}
+	for _, report := range leaderboardReports(config, snapshot) {
+		rows = append(rows, report.user.Username+" "+displayETH(report.ensReportList.totalWei(), 2))
+	}
+
+	return strings.Join(rows, ", ")
+}
+
+func TestLeaderboardReportsMentionsAndSharing(t *testing.T) {
+	tests := []struct {
+		name     string
+		mentions MentionPolicy
+		shared   SharedBalanceRule
+		expected string
+	}{
+		{"excluded mentions don't take a share", ExcludeMentions, SplitShared, "alice 10.00"},
+		{"downweighted mentions are discounted after splitting", DownweightMentions, SplitShared, "alice 5.00, bob 1.25"},
+		{"downweighted mentions are discounted from the full balance", DownweightMentions, CreditEveryone, "alice 10.00, bob 2.50"},
+		{"owners keep the whole balance", DownweightMentions, CreditOwner, "alice 10.00, bob 0.00"},
+		{"included mentions share like anyone else", IncludeMentions, SplitShared, "alice 5.00, bob 5.00"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := DefaultConfig()
+			config.Output.Mentions = test.mentions
+			config.Output.MentionWeight = 0.25
+			config.Output.SharedBalances = test.shared
+
+			if rows := leaderboardRows(config, sharedMentionSnapshot()); rows != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, rows)
+			}
+		})
+	}
+}
@@ -0,0 +1,449 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Everything configurable about a run lives here. Values are layered: built-in
+// defaults, then the YAML config file, then environment variables (including any
+// set in .env).
+type Config struct {
+	Providers   ProvidersConfig   `yaml:"providers"`
+	Cache       CacheConfig       `yaml:"cache"`
+	Paths       PathsConfig       `yaml:"paths"`
+	Crawl       CrawlConfig       `yaml:"crawl"`
+	Import      ImportConfig      `yaml:"import"`
+	Extract     ExtractConfig     `yaml:"extract"`
+	ENS         ENSConfig         `yaml:"ens"`
+	Concurrency ConcurrencyConfig `yaml:"concurrency"`
+	RateLimits  RateLimitsConfig  `yaml:"rate_limits"`
+	Price       PriceConfig       `yaml:"price"`
+	Output      OutputConfig      `yaml:"output"`
+	Filters     FiltersConfig     `yaml:"filters"`
+
+	path string // Where the config was loaded from, or empty if no file was found
+}
+
+type ProvidersConfig struct {
+	TwitterBearerToken string `yaml:"twitter_bearer_token"`
+	InfuraUrl          string `yaml:"infura_url"`
+	EtherscanApiKey    string `yaml:"etherscan_api_key"`
+}
+
+type PathsConfig struct {
+	Seed          string `yaml:"seed"`
+	Runs          string `yaml:"runs"`
+	ENSIgnoreList string `yaml:"ens_ignore_list"`
+}
+
+type CrawlConfig struct {
+	Depth       int    `yaml:"depth"`        // 1 only looks at who the seeds follow
+	MaxUsers    int    `yaml:"max_users"`    // 0 means unlimited
+	LevelBudget int    `yaml:"level_budget"` // Uncached page requests allowed per level per run
+	StatePath   string `yaml:"state_path"`
+}
+
+type ExtractConfig struct {
+	TLDs           []string `yaml:"tlds"`            // Name suffixes to look for, e.g. eth, xyz, id
+	Addresses      bool     `yaml:"addresses"`       // Also look for plain 0x addresses
+	ReverseResolve bool     `yaml:"reverse_resolve"` // Look up the primary name of those addresses
+	PinnedTweets   bool     `yaml:"pinned_tweets"`   // Also scan each user's pinned tweet
+
+	// Check each name's com.twitter text record when deciding whether it belongs to
+	// the user. Costs two extra lookups per name.
+	ConfirmTextRecords bool `yaml:"confirm_text_records"`
+}
+
+type ENSConfig struct {
+	Wildcard bool `yaml:"wildcard"`  // ENSIP-10 resolution through a parent name's resolver
+	CCIPRead bool `yaml:"ccip_read"` // EIP-3668 offchain lookups through HTTP gateways
+}
+
+type ConcurrencyConfig struct {
+	Lookups int `yaml:"lookups"` // Number of users resolved and balance checked in parallel
+}
+
+type RateLimitsConfig struct {
+	EtherscanPerSecond float64 `yaml:"etherscan_per_second"`
+	InfuraPerSecond    float64 `yaml:"infura_per_second"` // 0 means unlimited
+}
+
+type OutputFormat string
+
+const (
+	TableOutput OutputFormat = "table"
+	JSONOutput  OutputFormat = "json"
+)
+
+type OutputConfig struct {
+	Format          OutputFormat  `yaml:"format"`
+	ProximityWeight float64       `yaml:"proximity_weight"` // See WeightByProximity
+	Mentions        MentionPolicy `yaml:"mentions"`         // include, downweight, or exclude names that are likely mentions
+	MentionWeight   float64       `yaml:"mention_weight"`   // Fraction of a mention's balance kept when downweighting
+	Sort            SortKey       `yaml:"sort"`             // See SortKey. Empty keeps the ranking by balance.
+
+	// Who gets credit for an address claimed by several accounts: everyone, split,
+	// or owner. See SharedBalanceRule.
+	SharedBalances SharedBalanceRule `yaml:"shared_balances"`
+}
+
+type PriceConfig struct {
+	Oracle              string             `yaml:"oracle"`               // etherscan, chainlink, or static
+	ChainlinkAggregator string             `yaml:"chainlink_aggregator"` // ETH/USD feed read by the chainlink oracle
+	StaticUSD           string             `yaml:"static_usd"`           // Price used by the static oracle
+	Currency            Currency           `yaml:"currency"`             // Currency balances are shown in
+	FXRates             map[string]float64 `yaml:"fx_rates"`             // Units of each currency per US dollar
+
+	// Where prices for --at-block and --at-date come from: etherscan, chainlink,
+	// csv, or static. Empty uses the same kind of source as the oracle.
+	History    string `yaml:"history"`
+	HistoryCSV string `yaml:"history_csv"` // date,price rows for the csv history
+}
+
+type FiltersConfig struct {
+	MinETH       float64 `yaml:"min_eth"`
+	MinUSD       float64 `yaml:"min_usd"`
+	MinSeeds     int     `yaml:"min_seeds"`     // Only show users followed by at least this many seeds
+	MinFollowers int     `yaml:"min_followers"` // Only show users with at least this many followers
+	OnlyVerified bool    `yaml:"only_verified"`
+	DomainSuffix string  `yaml:"domain_suffix"` // Only show users with a name ending in this, e.g. .eth
+	Top          int     `yaml:"top"`           // 0 means show everyone
+}
+
+const DefaultConfigFile = "config/flex.yaml"
+
+func DefaultConfig() Config {
+	return Config{
+		Cache: CacheConfig{
+			Backend:    FileSystemCacheBackend,
+			BoltPath:   "data/cache.db",
+			TwitterDir: "data",
+			ENSDir:     "data/ens",
+			ETHDir:     "data/eth",
+		},
+		Paths: PathsConfig{
+			Seed:          "config/seed.json",
+			Runs:          "data/runs.db",
+			ENSIgnoreList: "data/ens/ignore.json",
+		},
+		Crawl: CrawlConfig{
+			Depth:       1,
+			LevelBudget: 15,
+			StatePath:   "data/crawl.json",
+		},
+		Extract:     ExtractConfig{TLDs: []string{"eth"}, Addresses: true},
+		ENS:         ENSConfig{Wildcard: true, CCIPRead: true},
+		Concurrency: ConcurrencyConfig{Lookups: 4},
+		RateLimits:  RateLimitsConfig{EtherscanPerSecond: 5},
+		Price:       PriceConfig{Oracle: EtherscanOracle, ChainlinkAggregator: DefaultChainlinkAggregator, Currency: USD},
+		Output:      OutputConfig{Format: TableOutput, Mentions: IncludeMentions, MentionWeight: 0.25, SharedBalances: SplitShared},
+	}
+}
+
+// Environment variables which override a config value. The first three predate the
+// config file and are kept so existing .env files continue to work.
+var configEnvOverrides = []struct {
+	name  string
+	apply func(config *Config, value string) error
+}{
+	{"TWITTER_BEARER_TOKEN", func(config *Config, value string) error {
+		config.Providers.TwitterBearerToken = value
+		return nil
+	}},
+	{"INFURA_URL", func(config *Config, value string) error {
+		config.Providers.InfuraUrl = value
+		return nil
+	}},
+	{"ETHERSCAN_API_KEY", func(config *Config, value string) error {
+		config.Providers.EtherscanApiKey = value
+		return nil
+	}},
+	{"CACHE_BACKEND", func(config *Config, value string) error {
+		config.Cache.Backend = CacheBackend(value)
+		return nil
+	}},
+	{"CACHE_BOLT_PATH", func(config *Config, value string) error {
+		config.Cache.BoltPath = value
+		return nil
+	}},
+	{"FLEX_SEED_FILE", func(config *Config, value string) error {
+		config.Paths.Seed = value
+		return nil
+	}},
+	{"FLEX_RUNS_DB", func(config *Config, value string) error {
+		config.Paths.Runs = value
+		return nil
+	}},
+	{"FLEX_IMPORT_ARCHIVE", func(config *Config, value string) error {
+		config.Import.ArchiveDir = value
+		return nil
+	}},
+	{"FLEX_IMPORT_CSV", func(config *Config, value string) error {
+		config.Import.CSV = value
+		return nil
+	}},
+	{"FLEX_CONCURRENCY", func(config *Config, value string) (err error) {
+		config.Concurrency.Lookups, err = strconv.Atoi(value)
+		return err
+	}},
+	{"FLEX_OUTPUT_FORMAT", func(config *Config, value string) error {
+		config.Output.Format = OutputFormat(value)
+		return nil
+	}},
+	{"FLEX_PRICE_ORACLE", func(config *Config, value string) error {
+		config.Price.Oracle = value
+		return nil
+	}},
+	{"FLEX_CURRENCY", func(config *Config, value string) error {
+		config.Price.Currency = Currency(strings.ToLower(value))
+		return nil
+	}},
+}
+
+// Load the config file named by FLEX_CONFIG (or config/flex.yaml). A missing file
+// is not an error so that a bare .env keeps working.
+func LoadConfig() (Config, error) {
+	// .env is optional now that the config file can hold the same values
+	godotenv.Load()
+
+	config := DefaultConfig()
+
+	configPath := os.Getenv("FLEX_CONFIG")
+	if configPath == "" {
+		configPath = DefaultConfigFile
+	}
+
+	contents, err := os.ReadFile(configPath)
+
+	switch {
+	case err == nil:
+		decoder := yaml.NewDecoder(bytes.NewReader(contents))
+		decoder.KnownFields(true)
+
+		if err := decoder.Decode(&config); err != nil {
+			return config, fmt.Errorf("could not parse %s: %w", configPath, err)
+		}
+
+		config.path = configPath
+	case os.IsNotExist(err) && os.Getenv("FLEX_CONFIG") == "":
+		logger.Debug("No config file at %s, using defaults and environment", configPath)
+	default:
+		return config, fmt.Errorf("could not read config file: %w", err)
+	}
+
+	for _, override := range configEnvOverrides {
+		value, isPresent := os.LookupEnv(override.name)
+		if !isPresent {
+			continue
+		}
+
+		if err := override.apply(&config, value); err != nil {
+			return config, fmt.Errorf("invalid value for %s: %w", override.name, err)
+		}
+	}
+
+	return config, nil
+}
+
+// Problems that make the config unusable for anything, including offline commands
+func (config Config) Validate() []error {
+	problems := []error{}
+
+	switch config.Cache.Backend {
+	case FileSystemCacheBackend, BoltCacheBackend, MemoryCacheBackend:
+	default:
+		problems = append(problems, fmt.Errorf("cache.backend: unknown backend %q (expected filesystem, bolt, or memory)", config.Cache.Backend))
+	}
+
+	if config.Cache.Backend == BoltCacheBackend && config.Cache.BoltPath == "" {
+		problems = append(problems, errors.New("cache.bolt_path: must be set when using the bolt backend"))
+	}
+
+	requiredPaths := map[string]string{
+		"cache.twitter_dir":     config.Cache.TwitterDir,
+		"cache.ens_dir":         config.Cache.ENSDir,
+		"cache.eth_dir":         config.Cache.ETHDir,
+		"paths.seed":            config.Paths.Seed,
+		"paths.runs":            config.Paths.Runs,
+		"paths.ens_ignore_list": config.Paths.ENSIgnoreList,
+	}
+
+	for _, key := range sortedKeys(requiredPaths) {
+		if requiredPaths[key] == "" {
+			problems = append(problems, fmt.Errorf("%s: must not be empty", key))
+		}
+	}
+
+	if config.Crawl.Depth < 1 {
+		problems = append(problems, fmt.Errorf("crawl.depth: must be at least 1, got %d", config.Crawl.Depth))
+	}
+
+	if config.Crawl.Depth > 1 && config.Crawl.LevelBudget < 1 {
+		problems = append(problems, errors.New("crawl.level_budget: must be at least 1 when crawling past depth 1"))
+	}
+
+	if config.Crawl.Depth > 1 && config.Crawl.StatePath == "" {
+		problems = append(problems, errors.New("crawl.state_path: must be set when crawling past depth 1"))
+	}
+
+	if config.Import.ArchiveDir != "" {
+		if pathType, _ := checkPathType(config.Import.ArchiveDir); pathType != IsDir {
+			problems = append(problems, fmt.Errorf("import.archive_dir: %s is not a directory", config.Import.ArchiveDir))
+		}
+	}
+
+	if config.Import.CSV != "" {
+		if pathType, _ := checkPathType(config.Import.CSV); pathType != IsFile {
+			problems = append(problems, fmt.Errorf("import.csv: %s does not exist", config.Import.CSV))
+		}
+	}
+
+	if len(config.Extract.TLDs) == 0 {
+		problems = append(problems, errors.New("extract.tlds: must list at least one TLD"))
+	}
+
+	for _, tld := range config.Extract.TLDs {
+		if tld == "" || strings.ContainsAny(tld, ". \t") {
+			problems = append(problems, fmt.Errorf("extract.tlds: %q should be a bare TLD like eth or xyz", tld))
+		}
+	}
+
+	if config.ENS.CCIPRead && !config.ENS.Wildcard {
+		problems = append(problems, errors.New("ens.ccip_read: requires ens.wildcard, since offchain names are resolved through ENSIP-10"))
+	}
+
+	if config.Crawl.MaxUsers < 0 {
+		problems = append(problems, errors.New("crawl.max_users: must not be negative (use 0 for unlimited)"))
+	}
+
+	if config.Concurrency.Lookups < 1 {
+		problems = append(problems, fmt.Errorf("concurrency.lookups: must be at least 1, got %d", config.Concurrency.Lookups))
+	}
+
+	if config.RateLimits.EtherscanPerSecond < 0 || config.RateLimits.InfuraPerSecond < 0 {
+		problems = append(problems, errors.New("rate_limits: limits must not be negative (use 0 for unlimited)"))
+	}
+
+	switch config.Output.Format {
+	case TableOutput, JSONOutput:
+	default:
+		problems = append(problems, fmt.Errorf("output.format: unknown format %q (expected table or json)", config.Output.Format))
+	}
+
+	if config.Filters.MinETH < 0 || config.Filters.MinUSD < 0 || config.Filters.MinSeeds < 0 || config.Filters.MinFollowers < 0 || config.Filters.Top < 0 {
+		problems = append(problems, errors.New("filters: min_eth, min_usd, min_seeds, min_followers, and top must not be negative"))
+	}
+
+	switch config.Price.Oracle {
+	case EtherscanOracle:
+	case ChainlinkOracle:
+		if !common.IsHexAddress(config.Price.ChainlinkAggregator) {
+			problems = append(problems, fmt.Errorf("price.chainlink_aggregator: %q is not an address", config.Price.ChainlinkAggregator))
+		}
+	case StaticOracle:
+		if _, err := parseDecimal(config.Price.StaticUSD); err != nil {
+			problems = append(problems, fmt.Errorf("price.static_usd: the static oracle needs a price, got %q", config.Price.StaticUSD))
+		}
+	default:
+		problems = append(problems, fmt.Errorf("price.oracle: unknown oracle %q (expected etherscan, chainlink, or static)", config.Price.Oracle))
+	}
+
+	switch config.Price.History {
+	case "", EtherscanOracle, ChainlinkOracle, StaticOracle:
+	case CSVOracle:
+		if config.Price.HistoryCSV == "" {
+			problems = append(problems, errors.New("price.history_csv: the csv price history needs a file"))
+		}
+	default:
+		problems = append(problems, fmt.Errorf("price.history: unknown source %q (expected etherscan, chainlink, csv, or static)", config.Price.History))
+	}
+
+	if config.Price.Currency.Symbol() == "" {
+		problems = append(problems, fmt.Errorf("price.currency: unsupported currency %q (expected usd, eur, gbp, or jpy)", config.Price.Currency))
+	} else if _, err := config.Price.Currency.Convert(big.NewRat(1, 1), config.Price.FXRates); err != nil {
+		problems = append(problems, fmt.Errorf("price.currency: %w", err))
+	}
+
+	for currency, rate := range config.Price.FXRates {
+		if rate <= 0 {
+			problems = append(problems, fmt.Errorf("price.fx_rates.%s: must be positive, got %g", currency, rate))
+		}
+	}
+
+	switch config.Output.SharedBalances {
+	case CreditEveryone, SplitShared, CreditOwner:
+	default:
+		problems = append(problems, fmt.Errorf("output.shared_balances: unknown rule %q (expected everyone, split, or owner)", config.Output.SharedBalances))
+	}
+
+	if config.Output.Sort != "" {
+		if err := config.Output.Sort.Validate(); err != nil {
+			problems = append(problems, fmt.Errorf("output.sort: %w", err))
+		}
+	}
+
+	if strings.TrimPrefix(config.Filters.DomainSuffix, ".") == "" && config.Filters.DomainSuffix != "" {
+		problems = append(problems, errors.New("filters.domain_suffix: must be a suffix like .eth or cb.id"))
+	}
+
+	if config.Output.ProximityWeight < 0 {
+		problems = append(problems, errors.New("output.proximity_weight: must not be negative"))
+	}
+
+	switch config.Output.Mentions {
+	case IncludeMentions, DownweightMentions, ExcludeMentions:
+	default:
+		problems = append(problems, fmt.Errorf("output.mentions: unknown policy %q (expected include, downweight, or exclude)", config.Output.Mentions))
+	}
+
+	if config.Output.MentionWeight < 0 || config.Output.MentionWeight > 1 {
+		problems = append(problems, fmt.Errorf("output.mention_weight: must be between 0 and 1, got %g", config.Output.MentionWeight))
+	}
+
+	return problems
+}
+
+// Problems that only matter for commands which talk to Twitter, Infura, or Etherscan
+func (config Config) ValidateProviders() []error {
+	problems := []error{}
+
+	// Offline imports build the pool from files, so Twitter isn't needed
+	if config.Providers.TwitterBearerToken == "" && !config.Import.Enabled() {
+		problems = append(problems, errors.New("providers.twitter_bearer_token: must be set (or TWITTER_BEARER_TOKEN)"))
+	}
+
+	if config.Providers.InfuraUrl == "" {
+		problems = append(problems, errors.New("providers.infura_url: must be set (or INFURA_URL)"))
+	} else if !strings.HasPrefix(config.Providers.InfuraUrl, "http") && !strings.HasPrefix(config.Providers.InfuraUrl, "ws") {
+		problems = append(problems, fmt.Errorf("providers.infura_url: expected an http(s) or ws(s) URL, got %q", config.Providers.InfuraUrl))
+	}
+
+	if config.Providers.EtherscanApiKey == "" {
+		problems = append(problems, errors.New("providers.etherscan_api_key: must be set (or ETHERSCAN_API_KEY)"))
+	}
+
+	return problems
+}
+
+func sortedKeys(values map[string]string) []string {
+	keys := []string{}
+
+	for key := range values {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Progress through each crawl level, persisted between runs. Following lists that
+// were already fetched come back out of the page cache for free, so this mostly
+// exists to remember accounts we can't read (e.g. protected) and to report how much
+// of a level is still waiting on rate limit budget.
+type CrawlState struct {
+	Levels []CrawlLevelState `json:"levels"`
+}
+
+type CrawlLevelState struct {
+	Level    int      `json:"level"`
+	Expanded []string `json:"expanded"` // User ids whose following lists have been fetched
+	Pending  []string `json:"pending"`  // User ids left for a future run, which starts with them
+	Skipped  []string `json:"skipped"`  // User ids whose following lists can't be fetched
+}
+
+func LoadCrawlState(path string) CrawlState {
+	state := CrawlState{}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return state
+	}
+
+	json.Unmarshal(contents, &state)
+
+	return state
+}
+
+func (state CrawlState) Persist(path string) {
+	serialized, err := json.MarshalIndent(state, "", "  ")
+	check(err)
+
+	check(EnsureDirExists(filepath.Dir(path)))
+	check(os.WriteFile(path, serialized, 0644))
+}
+
+func (state CrawlState) level(level int) CrawlLevelState {
+	for _, levelState := range state.Levels {
+		if levelState.Level == level {
+			return levelState
+		}
+	}
+
+	return CrawlLevelState{Level: level}
+}
+
+func (state *CrawlState) setLevel(levelState CrawlLevelState) {
+	for index, existing := range state.Levels {
+		if existing.Level == levelState.Level {
+			state.Levels[index] = levelState
+			return
+		}
+	}
+
+	state.Levels = append(state.Levels, levelState)
+}
+
+// Grow the pool past "people my seeds follow". Accounts with an ENS name found at
+// one level have their own follows pulled in at the next, up to the configured
+// depth. Each level may only spend `LevelBudget` uncached page requests per run
+// (Twitter allows 15 every 15 minutes) and stops early on a 429, leaving the rest
+// for the next run, which starts with whatever was left pending.
+//
+// Accounts found by crawling are credited to every seed that led to the account
+// that follows them, so seed filters and proximity weighting still apply. A 401
+// ends the crawl with an error, since every other request would fail the same way.
+func Crawl(client TwitterClient, cache Cache, config CrawlConfig, seed TwitterScrapeSeedInstructions, pool []TwitterUser, provenance SeedProvenance) ([]TwitterUser, error) {
+	state := LoadCrawlState(config.StatePath)
+
+	known := map[string]TwitterUser{}
+	for _, user := range pool {
+		known[user.Id] = user
+	}
+
+	expanded := map[string]bool{}
+	for _, user := range seed.Users {
+		if user.Id != nil {
+			expanded[*user.Id] = true
+		}
+	}
+
+	frontier := pool
+
+	for level := 2; level <= config.Depth; level++ {
+		previous := state.level(level)
+		skipped := map[string]bool{}
+		for _, userId := range previous.Skipped {
+			skipped[userId] = true
+		}
+
+		candidates, carried := crawlCandidates(frontier, previous.Pending, known, expanded, skipped)
+
+		levelState := CrawlLevelState{Level: level, Expanded: []string{}, Pending: carried, Skipped: append([]string{}, previous.Skipped...)}
+		discovered := []TwitterUser{}
+		liveRequests := 0
+		stopped := false
+		var crawlErr error
+
+		for _, user := range candidates {
+			atCapacity := config.MaxUsers > 0 && len(known) >= config.MaxUsers
+
+			if stopped || atCapacity || liveRequests >= config.LevelBudget && !client.IsUserListCached(FollowingEndpoint(user.Id), cache) {
+				levelState.Pending = append(levelState.Pending, user.Id)
+				continue
+			}
+
+			following, requests, complete, err := crawlFollowing(client, cache, user.Id, config.LevelBudget-liveRequests)
+			liveRequests += requests
+
+			if isUnauthorized(err) {
+				levelState.Pending = append(levelState.Pending, user.Id)
+				crawlErr = fmt.Errorf("twitter rejected the bearer token while crawling %s: %w", user.Username, err)
+				stopped = true
+				continue
+			}
+
+			if IsRateLimited(err) {
+				logger.Warn("Hit the Twitter rate limit while crawling level %d. Run again later to continue", level)
+				levelState.Pending = append(levelState.Pending, user.Id)
+				stopped = true
+				continue
+			}
+
+			if isDefinitiveLookupFailure(err) {
+				logger.Warn("Skipping %s while crawling: %s", user.Username, err)
+				levelState.Skipped = append(levelState.Skipped, user.Id)
+				continue
+			}
+
+			if err != nil {
+				logger.Warn("Could not crawl %s, will retry next run: %s", user.Username, err)
+				levelState.Pending = append(levelState.Pending, user.Id)
+				continue
+			}
+
+			// Out of budget partway through a long following list. The pages fetched
+			// so far are cached, so the next run continues from there.
+			if !complete {
+				levelState.Pending = append(levelState.Pending, user.Id)
+				continue
+			}
+
+			expanded[user.Id] = true
+			levelState.Expanded = append(levelState.Expanded, user.Id)
+
+			for _, followed := range following {
+				if _, isKnown := known[followed.Id]; isKnown || (config.MaxUsers > 0 && len(known) >= config.MaxUsers) {
+					continue
+				}
+
+				known[followed.Id] = followed
+				discovered = append(discovered, followed)
+			}
+
+			creditSeeds(provenance, user.Id, following, discovered)
+		}
+
+		logger.Info(
+			"Crawl level %d: expanded %d of %d accounts (%d live requests), found %d new users, %d pending",
+			level, len(levelState.Expanded), len(candidates), liveRequests, len(discovered), len(levelState.Pending),
+		)
+
+		state.setLevel(levelState)
+
+		// Keep what this level managed so a run with a working token picks up here
+		if crawlErr != nil {
+			state.Persist(config.StatePath)
+			return nil, crawlErr
+		}
+
+		pool = append(pool, discovered...)
+		frontier = discovered
+	}
+
+	state.Persist(config.StatePath)
+
+	return pool, nil
+}
+
+// Accounts to expand at a level: whatever the last run left pending first, in the
+// order it was left, then new accounts with an ENS name in a stable order. Pending
+// ids that aren't in the pool this run are carried over untouched.
+func crawlCandidates(frontier []TwitterUser, pending []string, known map[string]TwitterUser, expanded map[string]bool, skipped map[string]bool) ([]TwitterUser, []string) {
+	candidates := []TwitterUser{}
+	carried := []string{}
+	queued := map[string]bool{}
+
+	for _, userId := range pending {
+		user, isKnown := known[userId]
+
+		switch {
+		case expanded[userId] || skipped[userId] || queued[userId]:
+			continue
+		case !isKnown:
+			carried = append(carried, userId)
+		default:
+			candidates = append(candidates, user)
+		}
+
+		queued[userId] = true
+	}
+
+	fresh := []TwitterUser{}
+	for _, user := range frontier {
+		if !expanded[user.Id] && !skipped[user.Id] && !queued[user.Id] && len(user.ENSDomains()) > 0 {
+			fresh = append(fresh, user)
+		}
+	}
+
+	sort.Slice(fresh, func(i, j int) bool {
+		return fresh[i].Id < fresh[j].Id
+	})
+
+	return append(candidates, fresh...), carried
+}
+
+// Page through a following list, spending at most budget uncached requests.
+// Returns how many requests were spent and whether the whole list was read.
+func crawlFollowing(client TwitterClient, cache Cache, userId string, budget int) ([]TwitterUser, int, bool, error) {
+	endpoint := FollowingEndpoint(userId)
+	options := TwitterAPIListUsersRequestOptions{}
+	users := []TwitterUser{}
+	requests := 0
+
+	for {
+		if !cache.IsCached(endpoint.requestInput(options)) {
+			if requests >= budget {
+				return users, requests, false, nil
+			}
+
+			requests++
+		}
+
+		page, err := client.CachedListUsers(endpoint, cache, options)
+		if err != nil {
+			return users, requests, false, err
+		}
+
+		users = append(users, page.Data...)
+		options.PaginationToken = page.Meta.NextToken
+
+		if options.PaginationToken == nil {
+			return users, requests, true, nil
+		}
+	}
+}
+
+// Accounts that can't be read (protected, suspended, or deleted) are skipped for
+// good. Anything else, like a timeout or a 5xx, is retried on the next run.
+func isDefinitiveLookupFailure(err error) bool {
+	var statusError HTTPStatusError
+	if !errors.As(err, &statusError) {
+		return false
+	}
+
+	switch statusError.StatusCode {
+	case http.StatusForbidden, http.StatusNotFound:
+		return true
+	default:
+		return false
+	}
+}
+
+// A 401 is about our bearer token rather than the account being crawled, so it
+// stops the crawl instead of skipping everyone
+func isUnauthorized(err error) bool {
+	var statusError HTTPStatusError
+	return errors.As(err, &statusError) && statusError.StatusCode == http.StatusUnauthorized
+}
+
+// Credit accounts the crawl found through an expanded account to the seeds that
+// led to that account
+func creditSeeds(provenance SeedProvenance, expandedId string, following []TwitterUser, discovered []TwitterUser) {
+	isDiscovered := map[string]bool{}
+	for _, user := range discovered {
+		isDiscovered[user.Id] = true
+	}
+
+	for _, followed := range following {
+		if !isDiscovered[followed.Id] {
+			continue
+		}
+
+		for _, seedLabel := range provenance[expandedId] {
+			if !containsString(provenance[followed.Id], seedLabel) {
+				provenance[followed.Id] = append(provenance[followed.Id], seedLabel)
+			}
+		}
+	}
+}
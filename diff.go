@@ -0,0 +1,293 @@
+package main
+
+import (
+	"math"
+	"math/big"
+	"sort"
+)
+
+// Comparison between two stored runs. Everything is keyed by Twitter user id so
+// that username changes between runs don't show up as churn.
+type RunDiff struct {
+	From              string             `json:"from"`
+	To                string             `json:"to"`
+	Movers            []BalanceMove      `json:"movers"`
+	DomainChanges     []DomainChange     `json:"domain_changes"`
+	ResolutionChanges []ResolutionChange `json:"resolution_changes"`
+	RankChanges       []RankChange       `json:"rank_changes"`
+}
+
+// Wei amounts are serialized as strings, like balance_wei in snapshots, so JSON
+// consumers don't lose precision
+type BalanceMove struct {
+	Username      string   `json:"username"`
+	BeforeWei     string   `json:"before_wei"`
+	AfterWei      string   `json:"after_wei"`
+	ChangeWei     string   `json:"change_wei"`
+	PercentChange *float64 `json:"percent_change"` // Nil when the starting balance was zero
+	before        *big.Int
+	after         *big.Int
+	change        *big.Int
+}
+
+type DomainChange struct {
+	Username string      `json:"username"`
+	Added    []ENSDomain `json:"added"`
+	Removed  []ENSDomain `json:"removed"`
+}
+
+type ResolutionChangeKind string
+
+const (
+	StoppedResolving ResolutionChangeKind = "stopped_resolving"
+	StartedResolving ResolutionChangeKind = "started_resolving"
+	AddressChanged   ResolutionChangeKind = "address_changed"
+)
+
+type ResolutionChange struct {
+	Domain ENSDomain            `json:"domain"`
+	Kind   ResolutionChangeKind `json:"kind"`
+	Before *ETHAddress          `json:"before"`
+	After  *ETHAddress          `json:"after"`
+}
+
+type RankChange struct {
+	Username string `json:"username"`
+	Before   *int   `json:"before"` // Nil when the user wasn't on the leaderboard
+	After    *int   `json:"after"`  // Nil when the user dropped off the leaderboard
+}
+
+// Ranks come from the leaderboard as configured, so they match what `show` prints
+func DiffRuns(config Config, from RunSnapshot, to RunSnapshot) RunDiff {
+	fromReports := reportsByUserId(from.Reports())
+	toReports := reportsByUserId(to.Reports())
+
+	return RunDiff{
+		From:              from.Id,
+		To:                to.Id,
+		Movers:            diffBalances(fromReports, toReports),
+		DomainChanges:     diffDomains(fromReports, toReports),
+		ResolutionChanges: diffResolutions(from.Reports(), to.Reports()),
+		RankChanges:       diffRanks(leaderboardReports(config, from), leaderboardReports(config, to)),
+	}
+}
+
+func reportsByUserId(reports []UserENSReport) map[string]UserENSReport {
+	reportMap := map[string]UserENSReport{}
+
+	for _, report := range reports {
+		reportMap[report.user.Id] = report
+	}
+
+	return reportMap
+}
+
+func diffBalances(fromReports map[string]UserENSReport, toReports map[string]UserENSReport) []BalanceMove {
+	moves := []BalanceMove{}
+
+	for userId, toReport := range toReports {
+		fromReport, isPresent := fromReports[userId]
+		if !isPresent {
+			continue
+		}
+
+		before := fromReport.ensReportList.totalWei()
+		after := toReport.ensReportList.totalWei()
+
+		if before.Cmp(after) == 0 {
+			continue
+		}
+
+		change := new(big.Int).Sub(after, before)
+		move := BalanceMove{toReport.user.Username, before.String(), after.String(), change.String(), nil, before, after, change}
+
+		if before.Sign() != 0 {
+			percent, _ := new(big.Rat).SetFrac(new(big.Int).Mul(change, big.NewInt(100)), before).Float64()
+			move.PercentChange = &percent
+		}
+
+		moves = append(moves, move)
+	}
+
+	// Biggest moves first, by username when they tie since the reports come from a map
+	sort.SliceStable(moves, func(i, j int) bool {
+		if order := new(big.Int).Abs(moves[i].change).Cmp(new(big.Int).Abs(moves[j].change)); order != 0 {
+			return order > 0
+		}
+
+		return moves[i].Username < moves[j].Username
+	})
+
+	return moves
+}
+
+func diffDomains(fromReports map[string]UserENSReport, toReports map[string]UserENSReport) []DomainChange {
+	changes := []DomainChange{}
+
+	userIds := map[string]UserENSReport{}
+	for userId, report := range fromReports {
+		userIds[userId] = report
+	}
+	for userId, report := range toReports {
+		userIds[userId] = report
+	}
+
+	for userId, report := range userIds {
+		before := domainSet(fromReports[userId])
+		after := domainSet(toReports[userId])
+
+		change := DomainChange{report.user.Username, []ENSDomain{}, []ENSDomain{}}
+
+		for domain := range after {
+			if !before[domain] {
+				change.Added = append(change.Added, domain)
+			}
+		}
+
+		for domain := range before {
+			if !after[domain] {
+				change.Removed = append(change.Removed, domain)
+			}
+		}
+
+		if len(change.Added) == 0 && len(change.Removed) == 0 {
+			continue
+		}
+
+		sortDomains(change.Added)
+		sortDomains(change.Removed)
+		changes = append(changes, change)
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Username < changes[j].Username
+	})
+
+	return changes
+}
+
+func domainSet(report UserENSReport) map[ENSDomain]bool {
+	set := map[ENSDomain]bool{}
+
+	for _, ensReport := range report.ensReportList.reports {
+		if ensReport.domain != "" {
+			set[ensReport.domain] = true
+		}
+	}
+
+	return set
+}
+
+func sortDomains(domains []ENSDomain) {
+	sort.Slice(domains, func(i, j int) bool {
+		return domains[i] < domains[j]
+	})
+}
+
+func diffResolutions(from []UserENSReport, to []UserENSReport) []ResolutionChange {
+	before := resolutionsByDomain(from)
+	after := resolutionsByDomain(to)
+
+	changes := []ResolutionChange{}
+
+	for domain, afterReport := range after {
+		beforeReport, isPresent := before[domain]
+		if !isPresent {
+			continue
+		}
+
+		var kind ResolutionChangeKind
+
+		switch {
+		case beforeReport.valid && !afterReport.valid:
+			kind = StoppedResolving
+		case !beforeReport.valid && afterReport.valid:
+			kind = StartedResolving
+		case beforeReport.valid && afterReport.valid && *beforeReport.address != *afterReport.address:
+			kind = AddressChanged
+		default:
+			continue
+		}
+
+		changes = append(changes, ResolutionChange{domain, kind, beforeReport.address, afterReport.address})
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Domain < changes[j].Domain
+	})
+
+	return changes
+}
+
+func resolutionsByDomain(reports []UserENSReport) map[ENSDomain]ENSReport {
+	resolutions := map[ENSDomain]ENSReport{}
+
+	for _, userReport := range reports {
+		for _, report := range userReport.ensReportList.reports {
+			if report.domain != "" {
+				resolutions[report.domain] = report
+			}
+		}
+	}
+
+	return resolutions
+}
+
+// from and to are leaderboards, already filtered and sorted
+func diffRanks(from []UserENSReport, to []UserENSReport) []RankChange {
+	before := ranksByUserId(from)
+	after := ranksByUserId(to)
+
+	usernames := map[string]string{}
+	for _, report := range from {
+		usernames[report.user.Id] = report.user.Username
+	}
+	for _, report := range to {
+		usernames[report.user.Id] = report.user.Username
+	}
+
+	changes := []RankChange{}
+
+	for userId, username := range usernames {
+		beforeRank, wasRanked := before[userId]
+		afterRank, isRanked := after[userId]
+
+		if wasRanked && isRanked && beforeRank == afterRank {
+			continue
+		}
+
+		change := RankChange{Username: username}
+		if wasRanked {
+			change.Before = &beforeRank
+		}
+		if isRanked {
+			change.After = &afterRank
+		}
+
+		changes = append(changes, change)
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		return rankSortKey(changes[i]) < rankSortKey(changes[j])
+	})
+
+	return changes
+}
+
+// Order rank changes by where the user ended up, with users who dropped off last
+func rankSortKey(change RankChange) int {
+	if change.After == nil {
+		return math.MaxInt
+	}
+
+	return *change.After
+}
+
+func ranksByUserId(leaderboard []UserENSReport) map[string]int {
+	ranks := map[string]int{}
+	for index, report := range leaderboard {
+		ranks[report.user.Id] = index + 1
+	}
+
+	return ranks
+}
@@ -1,11 +1,18 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
 	ens "github.com/wealdtech/go-ens/v3"
 )
 
@@ -28,6 +35,8 @@ func NewIgnoreList(path string) IgnoreList {
 	pathType, err := checkPathType(path)
 	check(err)
 
+	check(EnsureDirExists(filepath.Dir(path)))
+
 	data := []ENSDomain{}
 
 	if pathType == IsFile {
@@ -52,7 +61,13 @@ func (list IgnoreList) Has(domain ENSDomain) bool {
 	return false
 }
 
+// Lookups run concurrently, so serialize the read-modify-write of the ignore file
+var ignoreListLock sync.Mutex
+
 func (list IgnoreList) Add(domain ENSDomain) {
+	ignoreListLock.Lock()
+	defer ignoreListLock.Unlock()
+
 	currentList := LoadIgnoreList(list.path)
 	newList := append(currentList, domain)
 
@@ -64,19 +79,34 @@ func (list IgnoreList) Add(domain ENSDomain) {
 
 type ENSClient struct {
 	client     *ethclient.Client
-	cache      FileSystemCache
+	cache      Cache
 	ignoreList IgnoreList
+	limiter    RateLimiter
+	options    ENSConfig
 }
 
-func NewENSClient(infuraUrl string) ENSClient {
-	client, err := ethclient.Dial(infuraUrl)
+func NewENSClient(infuraUrl string, cache Cache, ignoreListPath string, limiter RateLimiter, options ENSConfig) ENSClient {
+	client, err := dialEthereum(infuraUrl)
 	check(err)
 
-	cache := NewFileSystemCache("data/ens")
+	ignoreList := NewIgnoreList(ignoreListPath)
 
-	ignoreList := NewIgnoreList("data/ens/ignore.json")
+	return ENSClient{client, cache, ignoreList, limiter, options}
+}
+
+// HTTP endpoints go through the metered client so Infura shows up alongside the
+// other upstreams. Websocket and IPC endpoints are dialed as usual.
+func dialEthereum(url string) (*ethclient.Client, error) {
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return ethclient.Dial(url)
+	}
 
-	return ENSClient{client, cache, ignoreList}
+	client, err := rpc.DialHTTPWithClient(url, meteredHTTPClient)
+	if err != nil {
+		return nil, err
+	}
+
+	return ethclient.NewClient(client), nil
 }
 
 func (domain ENSDomain) CacheKey() string {
@@ -88,7 +118,7 @@ func (client ENSClient) CachedResolve(domain ENSDomain) (ETHAddress, error) {
 		return "", errors.New("domain failed to resolve and has been marked as ignored")
 	}
 
-	data, err := client.cache.WithRawCache(domain, func() ([]byte, error) {
+	data, err := WithRawCache(client.cache, domain, func() ([]byte, error) {
 		address, err := client.Resolve(domain)
 		if err != nil {
 			return nil, err
@@ -105,12 +135,188 @@ func (client ENSClient) CachedResolve(domain ENSDomain) (ETHAddress, error) {
 }
 
 func (client ENSClient) Resolve(domain ENSDomain) (ETHAddress, error) {
-	address, err := ens.Resolve(client.client, string(domain))
+	address, err := client.lookupAddress(string(domain))
 
-	if err != nil {
+	// Only names that definitely don't resolve are ignored from now on. A gateway
+	// 5xx or an RPC timeout gets another try next run.
+	if err != nil && isDefinitiveResolutionFailure(err) {
+		ensResolutionFailures.Inc(resolutionFailureReason(err))
 		client.ignoreList.Add(domain)
 		return "", err
 	}
 
+	if err != nil {
+		ensTransientFailures.Inc(resolutionFailureReason(err))
+		return "", err
+	}
+
 	return ETHAddress(address.String()), nil
 }
+
+// Bucket resolution errors into a few reasons for metrics. go-ens only returns
+// plain errors, so this goes by their messages.
+func resolutionFailureReason(err error) string {
+	var statusError HTTPStatusError
+	message := err.Error()
+
+	switch {
+	case strings.Contains(message, "unregistered name"):
+		return "unregistered"
+	case strings.Contains(message, "no resolver"):
+		return "no_resolver"
+	case strings.Contains(message, "no address"):
+		return "no_address"
+	case errors.As(err, &statusError), strings.Contains(message, "offchain lookup"), strings.Contains(message, "gateway"):
+		return "offchain_lookup"
+	default:
+		return "other"
+	}
+}
+
+// Whether a resolution error says the name has no such record, rather than that
+// the lookup itself failed
+func isDefinitiveResolutionFailure(err error) bool {
+	switch resolutionFailureReason(err) {
+	case "unregistered", "no_resolver", "no_address":
+		return true
+	default:
+		return false
+	}
+}
+
+// Cacheable subject for a reverse lookup of an address
+type ReverseLookup ETHAddress
+
+func (subject ReverseLookup) CacheKey() string {
+	return fmt.Sprintf("%s.reverse", string(subject))
+}
+
+var errNoPrimaryName = errors.New("address has no primary name")
+
+// Look up the primary name an address has set for itself. Addresses without a
+// primary name, or whose name doesn't resolve back to them, are cached as an empty
+// result so we don't ask again every run. Anything else, like an RPC timeout, is
+// returned uncached.
+func (client ENSClient) CachedReverseResolve(address ETHAddress) (ENSDomain, error) {
+	data, err := WithRawCache(client.cache, ReverseLookup(address), func() ([]byte, error) {
+		name, err := client.ReverseResolve(address)
+		if errors.Is(err, errNoPrimaryName) {
+			logger.Debug("No primary name for %s: %s", address, err)
+			return []byte{}, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		return []byte(name), nil
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if len(data) == 0 {
+		return "", errNoPrimaryName
+	}
+
+	return ENSDomain(data), nil
+}
+
+// Anyone can claim any name in their reverse record, so only trust it if the name
+// resolves back to the same address. Errors wrap errNoPrimaryName when the answer
+// is definitive rather than a failed request.
+func (client ENSClient) ReverseResolve(address ETHAddress) (ENSDomain, error) {
+	// Not ens.ReverseResolve, which reports a failed name() call as "no resolution"
+	client.limiter.Wait()
+	resolver, err := ens.NewReverseResolverFor(client.client, common.HexToAddress(string(address)))
+	if err != nil {
+		if err.Error() == "not a resolver" {
+			return "", fmt.Errorf("%w: no reverse resolver is set", errNoPrimaryName)
+		}
+		return "", err
+	}
+
+	client.limiter.Wait()
+	name, err := resolver.Name(common.HexToAddress(string(address)))
+	if err != nil {
+		return "", err
+	}
+
+	if name == "" {
+		return "", fmt.Errorf("%w: the reverse record is empty", errNoPrimaryName)
+	}
+
+	forward, err := client.lookupAddress(name)
+	if err != nil {
+		if isDefinitiveResolutionFailure(err) {
+			return "", fmt.Errorf("%w: %s claims %s but it doesn't resolve (%s)", errNoPrimaryName, address, name, err)
+		}
+		return "", err
+	}
+
+	if forward != common.HexToAddress(string(address)) {
+		return "", fmt.Errorf("%w: %s claims %s but resolves to %s", errNoPrimaryName, address, name, forward.String())
+	}
+
+	return ENSDomain(name), nil
+}
+
+// Cacheable subject for a text record of a name
+type TextRecordLookup struct {
+	domain ENSDomain
+	key    string
+}
+
+func (subject TextRecordLookup) CacheKey() string {
+	return fmt.Sprintf("%s.text.%s", subject.domain, subject.key)
+}
+
+// Look up a text record like com.twitter. Names without the record are cached as
+// an empty value; failed lookups are returned uncached.
+func (client ENSClient) CachedTextRecord(domain ENSDomain, key string) (string, error) {
+	data, err := WithRawCache(client.cache, TextRecordLookup{domain, key}, func() ([]byte, error) {
+		value, err := client.lookupText(string(domain), key)
+		if err != nil && isDefinitiveResolutionFailure(err) {
+			logger.Debug("No %s record for %s: %s", key, domain, err)
+			return []byte{}, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		return []byte(value), nil
+	})
+
+	return string(data), err
+}
+
+// Whether the name's com.twitter record names this user, which is about as strong
+// a claim of ownership as we can get. Accepts "alice", "@alice", and profile URLs.
+func (client ENSClient) ConfirmsTwitterHandle(domain ENSDomain, username string) bool {
+	record, err := client.CachedTextRecord(domain, "com.twitter")
+	if err != nil {
+		logger.Warn("Could not look up the com.twitter record of %s: %s", domain, err)
+		return false
+	}
+
+	if record == "" {
+		return false
+	}
+
+	record = strings.TrimSuffix(strings.TrimSpace(record), "/")
+	if index := strings.LastIndex(record, "/"); index >= 0 {
+		record = record[index+1:]
+	}
+
+	return strings.EqualFold(strings.TrimPrefix(record, "@"), username)
+}
+
+// The block the node is currently serving. Recorded alongside each run so balances
+// can be tied to a point in chain history.
+func (client ENSClient) BlockNumber() (uint64, error) {
+	client.limiter.Wait()
+
+	return client.client.BlockNumber(context.Background())
+}
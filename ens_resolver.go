@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+	ens "github.com/wealdtech/go-ens/v3"
+)
+
+// Name resolution following ENSIP-10 (wildcard resolution) and EIP-3668 (CCIP-Read).
+// go-ens only asks the resolver set on the exact name, which misses names like
+// alice.cb.id or bob.uni.eth that only exist through their parent's resolver, and
+// names whose records live offchain behind an HTTP gateway.
+//
+// @see https://docs.ens.domains/ens-improvement-proposals/ensip-10-wildcard-resolution
+// @see https://eips.ethereum.org/EIPS/eip-3668
+
+var ENSRegistryAddress = common.HexToAddress("0x00000000000C2E074eC69A0dFb2997BA6C7d2e1e")
+
+var (
+	resolverSelector          = selector("resolver(bytes32)")
+	supportsInterfaceSelector = selector("supportsInterface(bytes4)")
+	addrSelector              = selector("addr(bytes32)")
+	textSelector              = selector("text(bytes32,string)")
+	resolveSelector           = selector("resolve(bytes,bytes)") // Also the IExtendedResolver interface id
+	offchainLookupSelector    = selector("OffchainLookup(address,string[],bytes,bytes4,bytes)")
+)
+
+// EIP-3668 recommends capping how many lookups a single call may chain together
+const MaxOffchainLookups = 4
+
+func selector(signature string) []byte {
+	return crypto.Keccak256([]byte(signature))[:4]
+}
+
+func abiType(name string) abi.Type {
+	abiType, err := abi.NewType(name, "", nil)
+	check(err)
+
+	return abiType
+}
+
+var (
+	bytesArguments         = abi.Arguments{{Type: abiType("bytes")}}
+	stringArguments        = abi.Arguments{{Type: abiType("string")}}
+	textArguments          = abi.Arguments{{Type: abiType("bytes32")}, {Type: abiType("string")}}
+	twoBytesArguments      = abi.Arguments{{Type: abiType("bytes")}, {Type: abiType("bytes")}}
+	offchainLookupArgument = abi.Arguments{
+		{Name: "sender", Type: abiType("address")},
+		{Name: "urls", Type: abiType("string[]")},
+		{Name: "callData", Type: abiType("bytes")},
+		{Name: "callbackFunction", Type: abiType("bytes4")},
+		{Name: "extraData", Type: abiType("bytes")},
+	}
+)
+
+type OffchainLookup struct {
+	Sender           common.Address
+	Urls             []string
+	CallData         []byte
+	CallbackFunction [4]byte
+	ExtraData        []byte
+}
+
+func (client ENSClient) lookupAddress(name string) (common.Address, error) {
+	if !client.options.Wildcard {
+		client.limiter.Wait()
+		return ens.Resolve(client.client, name)
+	}
+
+	return client.resolveENSIP10(name)
+}
+
+func (client ENSClient) resolveENSIP10(name string) (common.Address, error) {
+	result, err := client.resolveRecord(name, func(node [32]byte) ([]byte, error) {
+		return append(append([]byte{}, addrSelector...), node[:]...), nil
+	})
+	if err != nil {
+		return common.Address{}, err
+	}
+
+	if len(result) < 32 {
+		return common.Address{}, fmt.Errorf("unexpected addr() result for %s: %x", name, result)
+	}
+
+	address := common.BytesToAddress(result[12:32])
+	if address == (common.Address{}) {
+		return common.Address{}, errors.New("no address")
+	}
+
+	return address, nil
+}
+
+// Look up a text record the same way lookupAddress looks up the address. An empty
+// value means the name has no such record.
+func (client ENSClient) lookupText(name string, key string) (string, error) {
+	if !client.options.Wildcard {
+		client.limiter.Wait()
+		resolver, err := ens.NewResolver(client.client, name)
+		if err != nil {
+			return "", err
+		}
+
+		client.limiter.Wait()
+		return resolver.Text(key)
+	}
+
+	result, err := client.resolveRecord(name, func(node [32]byte) ([]byte, error) {
+		arguments, err := textArguments.Pack(node, key)
+		return append(append([]byte{}, textSelector...), arguments...), err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unpacked, err := stringArguments.Unpack(result)
+	if err != nil {
+		return "", fmt.Errorf("unexpected text() result for %s: %w", name, err)
+	}
+
+	return unpacked[0].(string), nil
+}
+
+// Make a record call (addr, text, ...) for a name against its resolver, going
+// through resolve() for wildcard resolvers and following offchain lookups.
+// Returns the record call's ABI encoded result.
+func (client ENSClient) resolveRecord(name string, recordCall func(node [32]byte) ([]byte, error)) ([]byte, error) {
+	normalized, err := ens.Normalize(name)
+	if err != nil {
+		return nil, err
+	}
+
+	node, err := ens.NameHash(normalized)
+	if err != nil {
+		return nil, err
+	}
+
+	resolver, isExact, err := client.findResolver(normalized)
+	if err != nil {
+		return nil, err
+	}
+
+	call, err := recordCall(node)
+	if err != nil {
+		return nil, err
+	}
+
+	if client.supportsInterface(resolver, resolveSelector) {
+		resolveCall, err := twoBytesArguments.Pack(ens.DNSWireFormat(normalized), call)
+		if err != nil {
+			return nil, err
+		}
+
+		encoded, err := client.callWithOffchainLookup(resolver, append(append([]byte{}, resolveSelector...), resolveCall...))
+		if err != nil {
+			return nil, err
+		}
+
+		unpacked, err := bytesArguments.Unpack(encoded)
+		if err != nil {
+			return nil, err
+		}
+
+		return unpacked[0].([]byte), nil
+	}
+
+	if !isExact {
+		return nil, fmt.Errorf("%s has no resolver and its parent's resolver does not support wildcards", name)
+	}
+
+	return client.callWithOffchainLookup(resolver, call)
+}
+
+// Find the resolver for a name, walking up to its ancestors if the name itself has
+// none. Also reports whether the resolver was set on the exact name.
+func (client ENSClient) findResolver(name string) (common.Address, bool, error) {
+	labels := strings.Split(name, ".")
+
+	// Stop before the bare TLD, whose resolver isn't meant for wildcard use
+	for index := 0; index < len(labels)-1; index++ {
+		candidate := strings.Join(labels[index:], ".")
+
+		node, err := ens.NameHash(candidate)
+		if err != nil {
+			return common.Address{}, false, err
+		}
+
+		result, err := client.call(ENSRegistryAddress, append(append([]byte{}, resolverSelector...), node[:]...))
+		if err != nil {
+			return common.Address{}, false, err
+		}
+
+		resolver := common.BytesToAddress(result)
+		if resolver != (common.Address{}) {
+			return resolver, index == 0, nil
+		}
+	}
+
+	return common.Address{}, false, fmt.Errorf("no resolver found for %s", name)
+}
+
+func (client ENSClient) supportsInterface(contract common.Address, interfaceId []byte) bool {
+	call := append(append([]byte{}, supportsInterfaceSelector...), common.RightPadBytes(interfaceId, 32)...)
+
+	result, err := client.call(contract, call)
+	if err != nil || len(result) < 32 {
+		return false
+	}
+
+	return result[31] == 1
+}
+
+func (client ENSClient) call(contract common.Address, data []byte) ([]byte, error) {
+	client.limiter.Wait()
+
+	return client.client.CallContract(context.Background(), ethereum.CallMsg{To: &contract, Data: data}, nil)
+}
+
+// Make an eth_call, following any OffchainLookup reverts through their gateways
+func (client ENSClient) callWithOffchainLookup(contract common.Address, data []byte) ([]byte, error) {
+	for lookups := 0; ; lookups++ {
+		result, err := client.call(contract, data)
+		if err == nil {
+			return result, nil
+		}
+
+		revert, isRevert := revertData(err)
+		if !isRevert || !bytes.HasPrefix(revert, offchainLookupSelector) || !client.options.CCIPRead {
+			return nil, err
+		}
+
+		if lookups >= MaxOffchainLookups {
+			return nil, fmt.Errorf("gave up after %d offchain lookups", lookups)
+		}
+
+		lookup, err := DecodeOffchainLookup(revert)
+		if err != nil {
+			return nil, err
+		}
+
+		if lookup.Sender != contract {
+			return nil, fmt.Errorf("offchain lookup sender %s does not match %s", lookup.Sender, contract)
+		}
+
+		response, err := FetchOffchainData(lookup.Urls, lookup.Sender, lookup.CallData)
+		if err != nil {
+			return nil, err
+		}
+
+		callbackArguments, err := twoBytesArguments.Pack(response, lookup.ExtraData)
+		if err != nil {
+			return nil, err
+		}
+
+		data = append(lookup.CallbackFunction[:], callbackArguments...)
+	}
+}
+
+// Nodes return revert data as a hex string on the JSON-RPC error
+func revertData(err error) ([]byte, bool) {
+	var dataError rpc.DataError
+	if !errors.As(err, &dataError) {
+		return nil, false
+	}
+
+	encoded, isString := dataError.ErrorData().(string)
+	if !isString {
+		return nil, false
+	}
+
+	data, err := hexutil.Decode(encoded)
+
+	return data, err == nil
+}
+
+func DecodeOffchainLookup(revert []byte) (OffchainLookup, error) {
+	if !bytes.HasPrefix(revert, offchainLookupSelector) {
+		return OffchainLookup{}, errors.New("not an OffchainLookup revert")
+	}
+
+	var lookup OffchainLookup
+	unpacked, err := offchainLookupArgument.Unpack(revert[4:])
+	if err != nil {
+		return lookup, err
+	}
+
+	err = offchainLookupArgument.Copy(&lookup, unpacked)
+
+	return lookup, err
+}
+
+// Ask each gateway in turn for the response to an OffchainLookup. URLs containing
+// {data} are fetched with GET, others are sent the call data in a POST body. Per
+// EIP-3668 a 4xx response is final, while a 5xx or network error moves on to the
+// next gateway.
+func FetchOffchainData(urls []string, sender common.Address, callData []byte) ([]byte, error) {
+	senderHex := strings.ToLower(sender.Hex())
+	dataHex := hexutil.Encode(callData)
+
+	var lastErr error = errors.New("offchain lookup did not provide any gateway URLs")
+
+	for _, template := range urls {
+		url := strings.ReplaceAll(template, "{sender}", senderHex)
+
+		var body []byte
+		var err error
+
+		if strings.Contains(url, "{data}") {
+			body, err = StrictGetRequest(strings.ReplaceAll(url, "{data}", dataHex), nil)
+		} else {
+			body, err = StrictPostJSONRequest(url, map[string]string{"data": dataHex, "sender": senderHex})
+		}
+
+		var statusError HTTPStatusError
+		if errors.As(err, &statusError) && statusError.StatusCode >= 400 && statusError.StatusCode < 500 {
+			return nil, err
+		}
+
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		var response struct {
+			Data string `json:"data"`
+		}
+
+		if err := json.Unmarshal(body, &response); err != nil {
+			return nil, fmt.Errorf("gateway %s returned invalid JSON: %w", url, err)
+		}
+
+		return hexutil.Decode(response.Data)
+	}
+
+	return nil, lastErr
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+	ens "github.com/wealdtech/go-ens/v3"
+)
+
+var (
+	testResolverAddress = common.HexToAddress("0x000000000000000000000000000000000000e115")
+	testCallData        = []byte{0xde, 0xad, 0xbe, 0xef}
+	testExtraData       = []byte{0x01, 0x02}
+	testCallback        = [4]byte{0xca, 0x11, 0xba, 0xc4}
+)
+
+// A gateway that answers GET /ok/{sender}/{data} and POST /ok, and fails with the
+// status at the start of the path otherwise. Records each request's method and
+// first path segment.
+func newTestGateway(t *testing.T, requests *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		segments := strings.Split(request.URL.Path, "/")
+		*requests = append(*requests, request.Method+" /"+segments[1])
+
+		sender := strings.ToLower(testResolverAddress.Hex())
+		data := hexutil.Encode(testCallData)
+
+		switch request.Method + " /" + segments[1] {
+		case "GET /ok":
+			if request.URL.Path != "/ok/"+sender+"/"+data {
+				t.Errorf("gateway was sent GET %s", request.URL.Path)
+			}
+		case "POST /ok":
+			var body map[string]string
+			json.NewDecoder(request.Body).Decode(&body)
+
+			if body["sender"] != sender || body["data"] != data {
+				t.Errorf("gateway was posted %v", body)
+			}
+		case "GET /404":
+			writer.WriteHeader(http.StatusNotFound)
+			return
+		case "GET /500":
+			writer.WriteHeader(http.StatusInternalServerError)
+			return
+		default:
+			t.Errorf("unexpected gateway request %s %s", request.Method, request.URL.Path)
+			writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		io.WriteString(writer, `{"data":"0xc0ffee"}`)
+	}))
+}
+
+func TestFetchOffchainData(t *testing.T) {
+	tests := []struct {
+		name     string
+		urls     []string
+		requests []string
+		status   int // Of the expected HTTPStatusError, 0 for success
+	}{
+		{"GET with the data in the URL", []string{"/ok/{sender}/{data}"}, []string{"GET /ok"}, 0},
+		{"POST when the URL has no {data}", []string{"/ok"}, []string{"POST /ok"}, 0},
+		{"4xx is final", []string{"/404/{data}", "/ok"}, []string{"GET /404"}, http.StatusNotFound},
+		{"5xx moves on to the next gateway", []string{"/500/{data}", "/ok"}, []string{"GET /500", "POST /ok"}, 0},
+		{"5xx from every gateway", []string{"/500/{data}", "/500/{data}"}, []string{"GET /500", "GET /500"}, http.StatusInternalServerError},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			requests := []string{}
+			gateway := newTestGateway(t, &requests)
+			defer gateway.Close()
+
+			urls := []string{}
+			for _, url := range test.urls {
+				urls = append(urls, gateway.URL+url)
+			}
+
+			response, err := FetchOffchainData(urls, testResolverAddress, testCallData)
+
+			if strings.Join(requests, ", ") != strings.Join(test.requests, ", ") {
+				t.Errorf("expected requests %q, got %q", test.requests, requests)
+			}
+
+			if test.status == 0 {
+				if err != nil || !bytes.Equal(response, []byte{0xc0, 0xff, 0xee}) {
+					t.Errorf("expected 0xc0ffee, got %x, %v", response, err)
+				}
+				return
+			}
+
+			var statusError HTTPStatusError
+			if !errors.As(err, &statusError) || statusError.StatusCode != test.status {
+				t.Errorf("expected an HTTPStatusError with status %d, got %v", test.status, err)
+			}
+		})
+	}
+}
+
+func offchainLookupRevert(t *testing.T, lookup OffchainLookup) []byte {
+	packed, err := offchainLookupArgument.Pack(lookup.Sender, lookup.Urls, lookup.CallData, lookup.CallbackFunction, lookup.ExtraData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return append(append([]byte{}, offchainLookupSelector...), packed...)
+}
+
+// A JSON-RPC node whose eth_call either returns a result or reverts with the data
+// the contract function gives back
+func newTestNode(t *testing.T, contract func(data []byte) (result []byte, revert []byte)) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		var call struct {
+			Id     json.RawMessage   `json:"id"`
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+
+		var message struct {
+			Data string `json:"data"`
+		}
+
+		if err := json.NewDecoder(request.Body).Decode(&call); err != nil || call.Method != "eth_call" {
+			t.Errorf("unexpected RPC request %s (%v)", call.Method, err)
+			return
+		}
+
+		if err := json.Unmarshal(call.Params[0], &message); err != nil {
+			t.Errorf("unexpected eth_call params %s", call.Params[0])
+			return
+		}
+
+		result, revert := contract(hexutil.MustDecode(message.Data))
+
+		response := map[string]interface{}{"jsonrpc": "2.0", "id": call.Id}
+		if revert != nil {
+			response["error"] = map[string]interface{}{"code": 3, "message": "execution reverted", "data": hexutil.Encode(revert)}
+		} else {
+			response["result"] = hexutil.Encode(result)
+		}
+
+		json.NewEncoder(writer).Encode(response)
+	}))
+}
+
+func testENSClient(t *testing.T, node *httptest.Server) ENSClient {
+	client, err := ethclient.Dial(node.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ENSClient{client: client, options: ENSConfig{Wildcard: true, CCIPRead: true}}
+}
+
+func TestCallWithOffchainLookup(t *testing.T) {
+	tests := []struct {
+		name     string
+		sender   common.Address
+		chain    bool // Whether the callback reverts with another lookup
+		lookups  int  // Expected gateway requests
+		expected string
+	}{
+		{"follows the lookup through the callback", testResolverAddress, false, 1, ""},
+		{"gives up after the lookup limit", testResolverAddress, true, MaxOffchainLookups, "gave up after 4 offchain lookups"},
+		{"rejects a lookup for another sender", common.HexToAddress("0x0000000000000000000000000000000000000bad"), false, 0, "does not match"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			requests := []string{}
+			gateway := newTestGateway(t, &requests)
+			defer gateway.Close()
+
+			revert := offchainLookupRevert(t, OffchainLookup{
+				test.sender, []string{gateway.URL + "/ok/{sender}/{data}"}, testCallData, testCallback, testExtraData,
+			})
+
+			node := newTestNode(t, func(data []byte) ([]byte, []byte) {
+				if !bytes.HasPrefix(data, testCallback[:]) {
+					return nil, revert
+				}
+
+				arguments, err := twoBytesArguments.Unpack(data[4:])
+				if err != nil || !bytes.Equal(arguments[0].([]byte), []byte{0xc0, 0xff, 0xee}) || !bytes.Equal(arguments[1].([]byte), testExtraData) {
+					t.Errorf("callback called with %x", data)
+				}
+
+				if test.chain {
+					return nil, revert
+				}
+
+				return []byte("resolved"), nil
+			})
+			defer node.Close()
+
+			result, err := testENSClient(t, node).callWithOffchainLookup(testResolverAddress, []byte{0x01})
+
+			if len(requests) != test.lookups {
+				t.Errorf("expected %d gateway requests, got %q", test.lookups, requests)
+			}
+
+			if test.expected == "" {
+				if err != nil || string(result) != "resolved" {
+					t.Errorf("expected the callback's result, got %q, %v", result, err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), test.expected) {
+				t.Errorf("expected an error containing %q, got %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestDecodeOffchainLookup(t *testing.T) {
+	lookup := OffchainLookup{testResolverAddress, []string{"https://a/{data}", "https://b"}, testCallData, testCallback, testExtraData}
+
+	decoded, err := DecodeOffchainLookup(offchainLookupRevert(t, lookup))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if decoded.Sender != lookup.Sender || strings.Join(decoded.Urls, " ") != strings.Join(lookup.Urls, " ") ||
+		!bytes.Equal(decoded.CallData, lookup.CallData) || decoded.CallbackFunction != lookup.CallbackFunction ||
+		!bytes.Equal(decoded.ExtraData, lookup.ExtraData) {
+		t.Errorf("expected %+v, decoded %+v", lookup, decoded)
+	}
+
+	if _, err := DecodeOffchainLookup(append([]byte{0x08, 0xc3, 0x79, 0xa0}, testCallData...)); err == nil {
+		t.Error("expected an Error(string) revert to be rejected")
+	}
+}
+
+// bob.uni.eth has no resolver of its own, so the text record comes from uni.eth's
+// wildcard resolver, which defers to the gateway
+func TestLookupTextThroughWildcardResolver(t *testing.T) {
+	parent, _ := ens.NameHash("uni.eth")
+
+	requests := []string{}
+	gateway := newTestGateway(t, &requests)
+	defer gateway.Close()
+
+	node := newTestNode(t, func(data []byte) ([]byte, []byte) {
+		switch {
+		case bytes.HasPrefix(data, resolverSelector):
+			if bytes.Equal(data[4:], parent[:]) {
+				return common.LeftPadBytes(testResolverAddress.Bytes(), 32), nil
+			}
+			return make([]byte, 32), nil
+		case bytes.HasPrefix(data, supportsInterfaceSelector):
+			return common.LeftPadBytes([]byte{1}, 32), nil
+		case bytes.HasPrefix(data, resolveSelector):
+			return nil, offchainLookupRevert(t, OffchainLookup{
+				testResolverAddress, []string{gateway.URL + "/ok/{sender}/{data}"}, testCallData, testCallback, testExtraData,
+			})
+		case bytes.HasPrefix(data, testCallback[:]):
+			record, _ := stringArguments.Pack("@bob")
+			result, _ := bytesArguments.Pack(record)
+			return result, nil
+		default:
+			t.Errorf("unexpected call %x", data)
+			return nil, []byte{}
+		}
+	})
+	defer node.Close()
+
+	record, err := testENSClient(t, node).lookupText("bob.uni.eth", "com.twitter")
+	if err != nil || record != "@bob" {
+		t.Errorf("expected @bob, got %q, %v", record, err)
+	}
+}
@@ -3,16 +3,119 @@ package main
 import (
 	"fmt"
 	"math/big"
+	"strconv"
+	"strings"
 )
 
-func parseBigFloat(value string) (*big.Float, error) {
-	f := new(big.Float)
-	f.SetPrec(236) //  IEEE 754 octuple-precision binary floating-point format: binary256
-	f.SetMode(big.ToNearestEven)
-	_, err := fmt.Sscan(value, f)
-	return f, err
+// Balances are kept in wei as *big.Int from Etherscan to the report, and prices as
+// exact decimals in *big.Rat. Nothing is rounded until it is rendered.
+
+const ETHDecimals = 18
+const FiatDecimals = 2
+
+var weiPerETH = new(big.Int).Exp(big.NewInt(10), big.NewInt(ETHDecimals), nil)
+
+func parseWei(value string) (*big.Int, error) {
+	wei, isValid := new(big.Int).SetString(strings.TrimSpace(value), 10)
+	if !isValid {
+		return nil, fmt.Errorf("invalid wei amount %q", value)
+	}
+
+	return wei, nil
+}
+
+// Parse a decimal like "1834.27" exactly, without going through a float
+func parseDecimal(value string) (*big.Rat, error) {
+	decimal, isValid := new(big.Rat).SetString(strings.TrimSpace(value))
+	if !isValid {
+		return nil, fmt.Errorf("invalid decimal %q", value)
+	}
+
+	return decimal, nil
+}
+
+// The decimal a float was written as, e.g. 0.1 from a config file becomes exactly
+// 1/10 rather than the nearest binary fraction
+func floatToDecimal(value float64) *big.Rat {
+	decimal, err := parseDecimal(strconv.FormatFloat(value, 'f', -1, 64))
+	check(err)
+
+	return decimal
+}
+
+// Convert an amount of ETH to wei. Anything past 18 decimal places is rounded.
+func ethToWei(eth *big.Rat) *big.Int {
+	wei, err := parseWei(new(big.Rat).Mul(eth, new(big.Rat).SetInt(weiPerETH)).FloatString(0))
+	check(err)
+
+	return wei
+}
+
+func weiToETH(wei *big.Int) *big.Rat {
+	return new(big.Rat).SetFrac(wei, weiPerETH)
+}
+
+// What an amount of wei is worth at a price per ETH
+func weiValue(wei *big.Int, ethPrice *big.Rat) *big.Rat {
+	return new(big.Rat).Mul(weiToETH(wei), ethPrice)
+}
+
+// An approximation for ranking heuristics only. Never render or store this.
+func weiToFloat(wei *big.Int) float64 {
+	eth, _ := weiToETH(wei).Float64()
+
+	return eth
+}
+
+// The exact decimal value of an amount in ETH, e.g. "1.5" for 1.5e18 wei
+func FormatETH(wei *big.Int) string {
+	return formatDecimal(weiToETH(wei))
+}
+
+// Exact decimal text of a rational with up to 18 decimal places, trailing zeros
+// removed
+func formatDecimal(value *big.Rat) string {
+	text := value.FloatString(ETHDecimals)
+	text = strings.TrimRight(text, "0")
+
+	return strings.TrimSuffix(text, ".")
+}
+
+// ETH rounded for display, e.g. "1,234.57"
+func displayETH(wei *big.Int, decimals int) string {
+	return commafy(weiToETH(wei).FloatString(decimals))
 }
 
-func weiToEth(val *big.Float) *big.Float {
-	return val.Quo(val, big.NewFloat(1e18))
+// A fiat amount rounded to cents for display, e.g. "12,345.68"
+func displayFiat(amount *big.Rat) string {
+	return commafy(amount.FloatString(FiatDecimals))
+}
+
+func displayMoney(amount *big.Rat, currency Currency) string {
+	return commafy(amount.FloatString(currency.Decimals()))
+}
+
+// Put thousands separators into the integer part of a decimal string
+func commafy(decimal string) string {
+	sign := ""
+	if strings.HasPrefix(decimal, "-") {
+		sign, decimal = "-", decimal[1:]
+	}
+
+	integer, fraction, hasFraction := strings.Cut(decimal, ".")
+
+	var grouped strings.Builder
+	for index, digit := range integer {
+		if index > 0 && (len(integer)-index)%3 == 0 {
+			grouped.WriteRune(',')
+		}
+
+		grouped.WriteRune(digit)
+	}
+
+	if hasFraction {
+		return sign + grouped.String() + "." + fraction
+	}
+
+	return sign + grouped.String()
 }
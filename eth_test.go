@@ -0,0 +1,233 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+)
+
+// 123,456,789.123456789123456789 ETH, far past float64's 15-17 significant digits
+const whaleWei = "123456789123456789123456789"
+
+func TestParseWei(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected string // Empty when the value should be rejected
+	}{
+		{"0", "0"},
+		{"1500000000000000000", "1500000000000000000"},
+		{" 42\n", "42"},
+		{whaleWei, whaleWei},
+		{"", ""},
+		{"1.5", ""},
+		{"1e18", ""},
+		{"0x10", ""},
+		{"1,000", ""},
+		{"Max rate limit reached", ""},
+		{"Error! Invalid address format", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			wei, err := parseWei(test.value)
+
+			if test.expected == "" {
+				if err == nil {
+					t.Errorf("expected %q to be rejected, got %s", test.value, wei)
+				}
+				return
+			}
+
+			if err != nil || wei.String() != test.expected {
+				t.Errorf("expected %s, got %v, %v", test.expected, wei, err)
+			}
+		})
+	}
+}
+
+func TestParseDecimal(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected string // As a fraction, empty when the value should be rejected
+	}{
+		{"1834.27", "183427/100"},
+		{"0.1", "1/10"},
+		{" 2000 ", "2000/1"},
+		{"", ""},
+		{"1,834.27", ""},
+		{"$1834", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			decimal, err := parseDecimal(test.value)
+
+			if test.expected == "" {
+				if err == nil {
+					t.Errorf("expected %q to be rejected, got %s", test.value, decimal)
+				}
+				return
+			}
+
+			if err != nil || decimal.String() != test.expected {
+				t.Errorf("expected %s, got %v, %v", test.expected, decimal, err)
+			}
+		})
+	}
+}
+
+func TestFloatToDecimal(t *testing.T) {
+	tests := []struct {
+		value    float64
+		expected string
+	}{
+		{0.1, "1/10"},
+		{0.25, "1/4"},
+		{1834.27, "183427/100"},
+		{10, "10/1"},
+	}
+
+	for _, test := range tests {
+		if decimal := floatToDecimal(test.value); decimal.String() != test.expected {
+			t.Errorf("expected %v to be %s, got %s", test.value, test.expected, decimal)
+		}
+	}
+}
+
+func TestETHWeiConversion(t *testing.T) {
+	tests := []struct {
+		eth string
+		wei string
+	}{
+		{"1.5", "1500000000000000000"},
+		{"0.000000000000000001", "1"},
+		{"123456789.123456789123456789", whaleWei},
+		{"-1234.5", "-1234500000000000000000"},
+		// Fractions of a wei round to the nearest, halves away from zero
+		{"0.0000000000000000014", "1"},
+		{"0.0000000000000000015", "2"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.eth, func(t *testing.T) {
+			eth, err := parseDecimal(test.eth)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if wei := ethToWei(eth); wei.String() != test.wei {
+				t.Errorf("expected %s wei, got %s", test.wei, wei)
+			}
+		})
+	}
+}
+
+func TestFormatETH(t *testing.T) {
+	tests := []struct {
+		wei      string
+		expected string
+	}{
+		{"0", "0"},
+		{"1", "0.000000000000000001"},
+		{"1500000000000000000", "1.5"},
+		{"-1234500000000000000000", "-1234.5"},
+		{whaleWei, "123456789.123456789123456789"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.wei, func(t *testing.T) {
+			wei, _ := parseWei(test.wei)
+
+			if formatted := FormatETH(wei); formatted != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, formatted)
+			}
+		})
+	}
+}
+
+func TestDisplayETH(t *testing.T) {
+	tests := []struct {
+		wei      string
+		decimals int
+		expected string
+	}{
+		{"1234567890000000000000", 2, "1,234.57"},
+		{"1234565000000000000000", 2, "1,234.57"}, // Half rounds away from zero
+		{"999995000000000000000", 2, "1,000.00"},
+		{"-1234500000000000000000", 2, "-1,234.50"},
+		{"-1234565000000000000000", 2, "-1,234.57"},
+		{"4000000000000000", 2, "0.00"},
+		{whaleWei, 2, "123,456,789.12"},
+		{whaleWei, 18, "123,456,789.123456789123456789"},
+		{"1", 18, "0.000000000000000001"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expected, func(t *testing.T) {
+			wei, _ := parseWei(test.wei)
+
+			if displayed := displayETH(wei, test.decimals); displayed != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, displayed)
+			}
+		})
+	}
+}
+
+func TestDisplayMoney(t *testing.T) {
+	tests := []struct {
+		amount   string
+		currency Currency
+		expected string
+	}{
+		{"12345.675", USD, "12,345.68"},
+		{"12345.674", USD, "12,345.67"},
+		{"-1234.5", USD, "-1,234.50"},
+		{"0.004", Currency("eur"), "0.00"},
+		{"12345.5", Currency("jpy"), "12,346"},
+		{"999.4", Currency("jpy"), "999"},
+		{"-1234.5", Currency("jpy"), "-1,235"},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.currency)+" "+test.amount, func(t *testing.T) {
+			amount, _ := parseDecimal(test.amount)
+
+			if displayed := displayMoney(amount, test.currency); displayed != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, displayed)
+			}
+		})
+	}
+}
+
+// A whale's balance valued at a price with cents stays exact to the cent
+func TestWeiValue(t *testing.T) {
+	wei, _ := parseWei(whaleWei)
+	price, _ := parseDecimal("1834.27")
+
+	expected, _ := new(big.Rat).SetString("123456789.123456789123456789")
+	expected.Mul(expected, price)
+
+	if value := weiValue(wei, price); value.Cmp(expected) != 0 || displayFiat(value) != "226,453,084,585.48" {
+		t.Errorf("expected %s, got %s (%s)", expected.FloatString(2), value.FloatString(2), displayFiat(value))
+	}
+}
+
+func TestCommafy(t *testing.T) {
+	tests := []struct {
+		decimal  string
+		expected string
+	}{
+		{"0", "0"},
+		{"999", "999"},
+		{"1000", "1,000"},
+		{"-100", "-100"},
+		{"-1234.50", "-1,234.50"},
+		{"1234567.891", "1,234,567.891"},
+		{"123456789012345678901234567", "123,456,789,012,345,678,901,234,567"},
+	}
+
+	for _, test := range tests {
+		if grouped := commafy(test.decimal); grouped != test.expected {
+			t.Errorf("expected %s to be %s, got %s", test.decimal, test.expected, grouped)
+		}
+	}
+}
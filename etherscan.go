@@ -3,18 +3,19 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"math/big"
 	"net/url"
+	"strconv"
 	"time"
 )
 
 type EtherscanClient struct {
-	apiKey string
-	cache  FileSystemCache
+	apiKey  string
+	cache   Cache
+	limiter RateLimiter
 }
 
-func NewEtherscanClient(apiKey string) EtherscanClient {
-	return EtherscanClient{apiKey, NewFileSystemCache("data/eth")}
+func NewEtherscanClient(apiKey string, cache Cache, limiter RateLimiter) EtherscanClient {
+	return EtherscanClient{apiKey, cache, limiter}
 }
 
 const ApiUrl = "https://api.etherscan.io/api"
@@ -37,16 +38,12 @@ func (subject BalanceCheck) CacheKey() string {
 	return fmt.Sprintf("%s.balance", string(subject))
 }
 
-func (client EtherscanClient) CachedGetBalance(address ETHAddress) GetBalanceResponse {
+func (client EtherscanClient) CachedGetBalance(address ETHAddress) (GetBalanceResponse, error) {
 	logger.Debug("Looking up balance for %s", address)
 
-	result, err := WithJSONCache(client.cache, BalanceCheck(address), func() (GetBalanceResponse, error) {
+	return WithJSONCache(client.cache, BalanceCheck(address), func() (GetBalanceResponse, error) {
 		return client.GetBalance(address)
 	})
-
-	check(err)
-
-	return result
 }
 
 func (client EtherscanClient) GetBalance(address ETHAddress) (GetBalanceResponse, error) {
@@ -60,6 +57,8 @@ func (client EtherscanClient) GetBalance(address ETHAddress) (GetBalanceResponse
 		"apikey":  client.apiKey,
 	})
 
+	client.limiter.Wait()
+
 	body, err := StrictGetRequest(url, nil)
 	if err != nil {
 		return GetBalanceResponse{}, err
@@ -72,9 +71,6 @@ func (client EtherscanClient) GetBalance(address ETHAddress) (GetBalanceResponse
 		return GetBalanceResponse{}, fmt.Errorf("etherscan api response error: %s", result.Result)
 	}
 
-	// Etherscan rate limit = 5 requests per second
-	time.Sleep(150 * time.Millisecond)
-
 	return result, nil
 }
 
@@ -82,11 +78,13 @@ type GetPriceResponse struct {
 	Status  string
 	Message string
 	Result  struct {
-		Ethusd string `json:"ethusd"`
+		Ethusd          string `json:"ethusd"`
+		EthusdTimestamp string `json:"ethusd_timestamp"`
 	}
 }
 
-func (client EtherscanClient) GetETHUSDPrice() *big.Float {
+// Etherscan's stats/ethprice, which is also a PriceOracle
+func (client EtherscanClient) ETHUSDPrice() (PriceQuote, error) {
 	logger.Debug("Fetching ETH/USD price")
 
 	url := apiUrl(map[string]string{
@@ -95,16 +93,31 @@ func (client EtherscanClient) GetETHUSDPrice() *big.Float {
 		"apikey": client.apiKey,
 	})
 
+	client.limiter.Wait()
+
 	responseBody, err := StrictGetRequest(url, nil)
-	check(err)
+	if err != nil {
+		return PriceQuote{}, err
+	}
 
 	var result GetPriceResponse
-
 	json.Unmarshal(responseBody, &result)
 
-	price, err := parseBigFloat(result.Result.Ethusd)
-	check(err)
-	return price
+	if result.Message != "OK" {
+		return PriceQuote{}, fmt.Errorf("etherscan api response error: %s", result.Message)
+	}
+
+	price, err := parseDecimal(result.Result.Ethusd)
+	if err != nil {
+		return PriceQuote{}, err
+	}
+
+	timestamp := time.Now()
+	if seconds, err := strconv.ParseInt(result.Result.EthusdTimestamp, 10, 64); err == nil {
+		timestamp = time.Unix(seconds, 0)
+	}
+
+	return PriceQuote{price, EtherscanOracle, timestamp.UTC()}, nil
 }
 
 func apiUrl(params map[string]string) string {
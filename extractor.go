@@ -1,7 +1,12 @@
 package main
 
 import (
+	"net/url"
 	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/ethereum/go-ethereum/common"
 )
 
 type ENSDomain string
@@ -16,43 +21,423 @@ func ENSDomains(users []TwitterUser) []ENSDomain {
 	return extractedDomains
 }
 
-func (user TwitterUser) ENSDomains() []ENSDomain {
-	var domains []ENSDomain
+// Where in a profile a name was found
+type DomainSource string
+
+const (
+	HandleSource      DomainSource = "handle"
+	DisplayNameSource DomainSource = "display name"
+	BioSource         DomainSource = "bio"
+	URLSource         DomainSource = "url"
+	PinnedTweetSource DomainSource = "pinned tweet"
+	TextRecordSource  DomainSource = "text record" // The name's own com.twitter record points back at the user
+)
 
-	domains = append(domains, findENSDomain(user.Username)...)
-	domains = append(domains, findENSDomain(user.Name)...)
-	domains = append(domains, findENSDomain(user.Description)...)
-	// TODO: Check if the URL field (which is always a t.co domain) can resolve to an ENS domain?
+type DomainLocation struct {
+	Source DomainSource `json:"source"`
+	Offset int          `json:"offset"` // In runes from the start of the field, -1 if unknown
+}
+
+type DomainMatch struct {
+	Domain ENSDomain
+	DomainLocation
+}
 
-	uniqueDomains := []ENSDomain{}
+func (user TwitterUser) ENSDomains() []ENSDomain {
+	domains := []ENSDomain{}
 	seen := map[ENSDomain]bool{}
 
-	for _, domain := range domains {
-		if !seen[domain] {
-			uniqueDomains = append(uniqueDomains, domain)
-			seen[domain] = true
+	for _, match := range user.ENSDomainMatches() {
+		if !seen[match.Domain] {
+			domains = append(domains, match.Domain)
+			seen[match.Domain] = true
+		}
+	}
+
+	return domains
+}
+
+// Every place a name turns up in the profile, in the order handle, display name,
+// bio, links, pinned tweet. The same name may be matched more than once.
+func (user TwitterUser) ENSDomainMatches() []DomainMatch {
+	var matches []DomainMatch
+
+	matches = append(matches, findENSDomainMatches(user.Username, HandleSource)...)
+	matches = append(matches, findENSDomainMatches(user.Name, DisplayNameSource)...)
+	matches = append(matches, findENSDomainMatches(user.Description, BioSource)...)
+
+	for _, expandedUrl := range user.ExpandedUrls() {
+		matches = append(matches, findENSDomainMatchesInUrl(expandedUrl, URLSource)...)
+	}
+
+	if user.PinnedTweet != nil {
+		matches = append(matches, findENSDomainMatches(user.PinnedTweet.Text, PinnedTweetSource)...)
+
+		for _, expandedUrl := range user.PinnedTweet.ExpandedUrls() {
+			matches = append(matches, findENSDomainMatchesInUrl(expandedUrl, PinnedTweetSource)...)
 		}
 	}
 
-	return uniqueDomains
+	return matches
 }
 
-/*
- * Based on first Google result for "ENS Domain Regular Expression"
- * @see https://www.regextester.com/111178
- *
- * NOTE: This was more helpful than scouring multiple ENS packages for an actual regex 🤷‍♂️
- */
-var ensPattern = regexp.MustCompile(`[-a-zA-Z0-9@:%._\+~#=]{1,256}\.eth`)
+// Where each of the user's names was found
+func (user TwitterUser) ENSDomainLocations() map[ENSDomain][]DomainLocation {
+	locations := map[ENSDomain][]DomainLocation{}
+
+	for _, match := range user.ENSDomainMatches() {
+		locations[match.Domain] = append(locations[match.Domain], match.DomainLocation)
+	}
+
+	return locations
+}
+
+// TLDs whose names we look for. Besides .eth, ENS can resolve DNS names imported
+// with DNSSEC (.xyz, .art, ...) and offchain names under other TLDs (e.g. cb.id),
+// so this is configurable with extract.tlds.
+var ensTLDs = []string{"eth"}
+
+func ConfigureExtractor(config ExtractConfig) {
+	if len(config.TLDs) > 0 {
+		ensTLDs = config.TLDs
+	}
+}
+
+// Gateway suffixes that may directly follow a name in plain text, e.g. alice.eth.limo
+var ensGatewayTLDs = []string{"limo", "link"}
 
 func findENSDomain(input string) []ENSDomain {
-	matches := ensPattern.FindAll([]byte(input), -1)
+	return matchedDomains(scanENSNames([]rune(input), ensTLDs))
+}
+
+func findENSDomainMatches(input string, source DomainSource) []DomainMatch {
+	matches := scanENSNames([]rune(input), ensTLDs)
 
-	var strings []ENSDomain
+	for index := range matches {
+		matches[index].Source = source
+	}
+
+	return matches
+}
+
+func matchedDomains(matches []DomainMatch) []ENSDomain {
+	var domains []ENSDomain
 
 	for _, match := range matches {
-		strings = append(strings, ENSDomain(string(match)))
+		domains = append(domains, match.Domain)
+	}
+
+	return domains
+}
+
+// Find ENS names by scanning for a known TLD and walking backwards over labels.
+//
+// A name is one or more dot separated labels followed by the TLD. Labels may use any
+// Unicode letter, digit, or mark, hyphens, and underscores, or else emoji (including
+// ZWJ sequences). Anything else (whitespace, most punctuation, @, :, /, ...) ends the
+// name. So "gm, I'm pay.alice.eth!" yields pay.alice.eth and "🦄.eth" yields 🦄.eth.
+//
+// A match is rejected when
+//   - the TLD runs on into more label characters ("alice.ethereum")
+//   - the TLD is followed by a dot and another label, unless that label is an ENS
+//     gateway ("alice.eth.limo" is fine, "alice.eth.com" is a DNS name)
+//   - it is the domain half of an email address ("me@alice.eth")
+func scanENSNames(text []rune, tlds []string) []DomainMatch {
+	var names []DomainMatch
+
+	for position := 0; position < len(text); position++ {
+		if text[position] != '.' {
+			continue
+		}
+
+		tld := matchTLD(text, position+1, tlds)
+		if tld == "" {
+			continue
+		}
+
+		nameStart := scanLabelsBackwards(text, position)
+		if nameStart == position {
+			continue
+		}
+
+		if isEmailDomain(text, nameStart) {
+			continue
+		}
+
+		name := strings.ToLower(string(text[nameStart:position])) + "." + tld
+		names = append(names, DomainMatch{ENSDomain(name), DomainLocation{Offset: nameStart}})
+	}
+
+	return names
+}
+
+// Returns the TLD starting at `start` (matched case-insensitively) which is followed
+// by the end of the name, or an empty string if there isn't one. Every TLD is tried
+// so that "eth" doesn't shadow a longer configured TLD like "ethereum".
+func matchTLD(text []rune, start int, tlds []string) string {
+	for _, tld := range tlds {
+		end := start + len([]rune(tld))
+		if end > len(text) {
+			continue
+		}
+
+		if strings.EqualFold(string(text[start:end]), tld) && isNameTerminator(text, end) {
+			return strings.ToLower(tld)
+		}
+	}
+
+	return ""
+}
+
+func isNameTerminator(text []rune, position int) bool {
+	if position >= len(text) {
+		return true
+	}
+
+	// Emoji right after the TLD separate it from whatever follows, as in "alice.eth✨"
+	if isLabelRune(text[position]) && !isEmojiPart(text, position) {
+		return false
+	}
+
+	if text[position] != '.' {
+		return true
+	}
+
+	// A dot is fine as sentence punctuation, or when followed by a gateway suffix
+	next := position + 1
+	if next >= len(text) || !isLabelRune(text[next]) {
+		return true
+	}
+
+	for _, gateway := range ensGatewayTLDs {
+		end := next + len(gateway)
+
+		if end <= len(text) && strings.EqualFold(string(text[next:end]), gateway) && (end == len(text) || !isLabelRune(text[end])) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Walk backwards from the dot before the TLD over labels and the dots between them.
+// Stops at the first non-label character, or at an empty label ("foo..bar.eth"
+// yields bar.eth).
+func scanLabelsBackwards(text []rune, tldDot int) int {
+	start := scanLabelBackwards(text, tldDot)
+
+	for start > 1 && text[start-1] == '.' && isLabelRune(text[start-2]) {
+		start = scanLabelBackwards(text, start-1)
+	}
+
+	return start
+}
+
+// A label is either emoji or text. Bios use emoji as decoration and separators far
+// more often than inside names, so "✨alice.eth" yields alice.eth rather than
+// ✨alice.eth.
+func scanLabelBackwards(text []rune, end int) int {
+	start := end
+
+	for start > 0 && isLabelRune(text[start-1]) && isEmojiPart(text, start-1) == isEmojiPart(text, end-1) {
+		start--
+	}
+
+	return start
+}
+
+// "me@alice.eth" is an email, but "@alice.eth" on its own is someone mentioning a name
+func isEmailDomain(text []rune, nameStart int) bool {
+	return nameStart >= 2 && text[nameStart-1] == '@' && isLabelRune(text[nameStart-2])
+}
+
+func isLabelRune(character rune) bool {
+	switch {
+	case character == '-' || character == '_':
+		return true
+	case unicode.IsLetter(character) || unicode.IsDigit(character) || unicode.IsMark(character):
+		return true
+	case isEmojiRune(character):
+		return true
+	default:
+		return false
+	}
+}
+
+// Roughly the Extended_Pictographic ranges, plus the characters that glue emoji
+// sequences together. ENS normalization only allows symbols that are emoji, so
+// other symbols like box drawing (═) or ⌘ end a name.
+var emojiRunes = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{0x00a9, 0x00ae, 5},  // © ®
+		{0x200d, 0x200d, 1},  // Zero width joiner
+		{0x203c, 0x2049, 13}, // ‼ ⁉
+		{0x20e3, 0x20e3, 1},  // Combining keycap
+		{0x2122, 0x2139, 23}, // ™ ℹ
+		{0x2194, 0x2199, 1},  // Arrows
+		{0x21a9, 0x21aa, 1},  // Arrows
+		{0x231a, 0x231b, 1},  // ⌚ ⌛
+		{0x2328, 0x2328, 1},  // ⌨
+		{0x23cf, 0x23cf, 1},  // ⏏
+		{0x23e9, 0x23f3, 1},  // ⏩ ... ⏳
+		{0x23f8, 0x23fa, 1},  // ⏸ ⏹ ⏺
+		{0x24c2, 0x24c2, 1},  // Ⓜ
+		{0x25aa, 0x25ab, 1},  // ▪ ▫
+		{0x25b6, 0x25c0, 10}, // ▶ ◀
+		{0x25fb, 0x25fe, 1},  // ◻ ... ◾
+		{0x2600, 0x27bf, 1},  // Miscellaneous symbols and dingbats
+		{0x2934, 0x2935, 1},  // ⤴ ⤵
+		{0x2b05, 0x2b07, 1},  // ⬅ ⬆ ⬇
+		{0x2b1b, 0x2b1c, 1},  // ⬛ ⬜
+		{0x2b50, 0x2b55, 5},  // ⭐ ⭕
+		{0x3030, 0x303d, 13}, // 〰 〽
+		{0x3297, 0x3299, 2},  // ㊗ ㊙
+		{0xfe00, 0xfe0f, 1},  // Variation selectors
+	},
+	R32: []unicode.Range32{
+		{0x1f000, 0x1faff, 1}, // Emoji blocks, including flags and skin tones
+		{0xe0020, 0xe007f, 1}, // Tags, for subdivision flags
+	},
+	LatinOffset: 1,
+}
+
+func isEmojiRune(character rune) bool {
+	return unicode.Is(emojiRunes, character)
+}
+
+// Whether the rune at position belongs to an emoji sequence, counting the digit
+// at the start of a keycap like 1️⃣
+func isEmojiPart(text []rune, position int) bool {
+	if isEmojiRune(text[position]) {
+		return true
+	}
+
+	next := position + 1
+
+	return unicode.IsDigit(text[position]) && next < len(text) && (text[next] == '\ufe0f' || text[next] == '\u20e3')
+}
+
+// Gateways which serve an ENS name's content at <name>.limo / <name>.link
+var ensGatewaySuffixes = []string{".eth.limo", ".eth.link"}
+
+// Sites whose paths or query strings contain an ENS name, e.g.
+// app.ens.domains/name/foo.eth or etherscan.io/address/foo.eth
+var ensLinkHosts = map[string]bool{
+	"app.ens.domains": true,
+	"ens.domains":     true,
+	"ens.app":         true,
+	"etherscan.io":    true,
+}
+
+// Pull ENS names out of links like foo.eth.limo or app.ens.domains/name/foo.eth
+func findENSDomainInUrl(rawUrl string) []ENSDomain {
+	if !strings.Contains(rawUrl, "://") {
+		rawUrl = "https://" + rawUrl
+	}
+
+	parsed, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil
+	}
+
+	host := strings.TrimPrefix(strings.ToLower(parsed.Hostname()), "www.")
+
+	for _, suffix := range ensGatewaySuffixes {
+		if strings.HasSuffix(host, suffix) {
+			return matchedDomains(scanENSNames([]rune(strings.TrimSuffix(host, suffix)+".eth"), []string{"eth"}))
+		}
+	}
+
+	if !ensLinkHosts[host] {
+		return nil
+	}
+
+	var domains []ENSDomain
+
+	for _, segment := range strings.Split(parsed.Path, "/") {
+		domains = append(domains, findENSDomain(segment)...)
+	}
+
+	for _, values := range parsed.Query() {
+		for _, value := range values {
+			domains = append(domains, findENSDomain(value)...)
+		}
+	}
+
+	return domains
+}
+
+// Names in a link, located by where they appear in the link text. Names that only
+// appear percent-encoded get an offset of -1.
+func findENSDomainMatchesInUrl(rawUrl string, source DomainSource) []DomainMatch {
+	var matches []DomainMatch
+	lowered := strings.ToLower(rawUrl)
+
+	for _, domain := range findENSDomainInUrl(rawUrl) {
+		offset := -1
+
+		if index := strings.Index(lowered, string(domain)); index >= 0 {
+			offset = len([]rune(lowered[:index]))
+		}
+
+		matches = append(matches, DomainMatch{domain, DomainLocation{source, offset}})
+	}
+
+	return matches
+}
+
+// Addresses posted directly rather than behind an ENS name. The word boundaries
+// keep us from matching the first 40 characters of a transaction hash.
+var addressPattern = regexp.MustCompile(`\b0x[0-9a-fA-F]{40}\b`)
+
+func (user TwitterUser) ETHAddresses() []ETHAddress {
+	var addresses []ETHAddress
+
+	addresses = append(addresses, findETHAddresses(user.Name)...)
+	addresses = append(addresses, findETHAddresses(user.Description)...)
+
+	for _, expandedUrl := range user.ExpandedUrls() {
+		addresses = append(addresses, findETHAddresses(expandedUrl)...)
+	}
+
+	uniqueAddresses := []ETHAddress{}
+	seen := map[ETHAddress]bool{}
+
+	for _, address := range addresses {
+		if !seen[address] {
+			uniqueAddresses = append(uniqueAddresses, address)
+			seen[address] = true
+		}
+	}
+
+	return uniqueAddresses
+}
+
+func findETHAddresses(input string) []ETHAddress {
+	var addresses []ETHAddress
+
+	for _, match := range addressPattern.FindAllString(input, -1) {
+		if address, isValid := parseETHAddress(match); isValid {
+			addresses = append(addresses, address)
+		}
+	}
+
+	return addresses
+}
+
+// Validate an address against its EIP-55 checksum and normalize it to the
+// checksummed form. All-lowercase and all-uppercase addresses carry no checksum and
+// are accepted as-is, but a mixed case address that fails the checksum is almost
+// certainly a typo.
+func parseETHAddress(raw string) (ETHAddress, bool) {
+	hexDigits := raw[2:]
+	checksummed := common.HexToAddress(raw).Hex()
+
+	isUnchecksummed := hexDigits == strings.ToLower(hexDigits) || hexDigits == strings.ToUpper(hexDigits)
+
+	if !isUnchecksummed && checksummed != raw {
+		return "", false
 	}
 
-	return strings
+	return ETHAddress(checksummed), true
 }
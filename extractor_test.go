@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+// A bio and the names the extractor is expected to find in it, in order
+type extractorCorpusEntry struct {
+	Text  string      `json:"text"`
+	Names []ENSDomain `json:"names"`
+}
+
+// Golden corpus of real-world bios. Add a line whenever you find one the extractor
+// gets wrong.
+func TestExtractorCorpus(t *testing.T) {
+	contents, err := os.ReadFile("testdata/extractor_corpus.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var entries []extractorCorpusEntry
+	if err := json.Unmarshal(contents, &entries); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, entry := range entries {
+		t.Run(entry.Text, func(t *testing.T) {
+			found := findENSDomain(entry.Text)
+
+			if joinDomains(found) != joinDomains(entry.Names) {
+				t.Errorf("expected [%s], found [%s]", joinDomains(entry.Names), joinDomains(found))
+			}
+		})
+	}
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Point-in-time reports value balances at a past block with the ETH price of that
+// day, instead of today's price. ENS names are still resolved as they are now.
+type PointInTime struct {
+	Block uint64
+	Date  time.Time // The block's day, in UTC
+}
+
+const DateFormat = "2006-01-02"
+
+type HistoricalPriceOracle interface {
+	ETHUSDPriceAt(at PointInTime) (PriceQuote, error)
+}
+
+const CSVOracle = "csv"
+
+// Pick the historical counterpart of the configured oracle, unless price.history
+// names a different one
+func NewHistoricalPriceOracle(config PriceConfig, etherscan EtherscanClient, ens ENSClient) (HistoricalPriceOracle, string, error) {
+	source := config.History
+	if source == "" {
+		source = config.Oracle
+	}
+
+	switch source {
+	case EtherscanOracle:
+		return etherscan, source, nil
+	case ChainlinkOracle:
+		return ChainlinkPriceOracle{ens.client, common.HexToAddress(config.ChainlinkAggregator), ens.limiter}, source, nil
+	case StaticOracle:
+		oracle, err := NewStaticPriceOracle(config.StaticUSD)
+		return oracle, source, err
+	case CSVOracle:
+		return CSVPriceHistory{config.HistoryCSV}, source, nil
+	default:
+		return nil, source, fmt.Errorf("unknown price history source %q", source)
+	}
+}
+
+// Cacheable subject for one day's price from one source
+type DailyPrice struct {
+	source string
+	date   time.Time
+}
+
+func (subject DailyPrice) CacheKey() string {
+	return fmt.Sprintf("eth-usd.%s.%s", subject.source, subject.date.Format(DateFormat))
+}
+
+// PriceQuote with the price as exact decimal text, for the cache
+type cachedPriceQuote struct {
+	Price     string    `json:"price"`
+	Source    string    `json:"source"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Prices are cached per day, so every report for the same day shares one lookup
+func CachedHistoricalPrice(cache Cache, oracle HistoricalPriceOracle, source string, at PointInTime) (PriceQuote, error) {
+	cached, err := WithJSONCache(cache, DailyPrice{source, at.Date}, func() (cachedPriceQuote, error) {
+		quote, err := oracle.ETHUSDPriceAt(at)
+		if err != nil {
+			return cachedPriceQuote{}, err
+		}
+
+		return cachedPriceQuote{formatDecimal(quote.Price), quote.Source, quote.Timestamp}, nil
+	})
+
+	if err != nil {
+		return PriceQuote{}, err
+	}
+
+	price, err := parseDecimal(cached.Price)
+	if err != nil {
+		return PriceQuote{}, err
+	}
+
+	return PriceQuote{price, cached.Source, cached.Timestamp}, nil
+}
+
+type GetDailyPriceResponse struct {
+	Status  string
+	Message string
+	Result  json.RawMessage
+}
+
+// Etherscan's stats/ethdailyprice. This is an API Pro endpoint; free keys get an
+// error message back instead.
+func (client EtherscanClient) ETHUSDPriceAt(at PointInTime) (PriceQuote, error) {
+	date := at.Date.Format(DateFormat)
+
+	url := apiUrl(map[string]string{
+		"module":    "stats",
+		"action":    "ethdailyprice",
+		"startdate": date,
+		"enddate":   date,
+		"sort":      "asc",
+		"apikey":    client.apiKey,
+	})
+
+	client.limiter.Wait()
+
+	responseBody, err := StrictGetRequest(url, nil)
+	if err != nil {
+		return PriceQuote{}, err
+	}
+
+	var response GetDailyPriceResponse
+	json.Unmarshal(responseBody, &response)
+
+	var days []struct {
+		UnixTimeStamp string `json:"unixTimeStamp"`
+		Value         string `json:"value"`
+	}
+
+	if response.Message != "OK" || json.Unmarshal(response.Result, &days) != nil || len(days) == 0 {
+		return PriceQuote{}, fmt.Errorf("etherscan has no daily price for %s: %s %s", date, response.Message, response.Result)
+	}
+
+	price, err := parseDecimal(days[0].Value)
+	if err != nil {
+		return PriceQuote{}, err
+	}
+
+	timestamp := at.Date
+	if seconds, err := strconv.ParseInt(days[0].UnixTimeStamp, 10, 64); err == nil {
+		timestamp = time.Unix(seconds, 0).UTC()
+	}
+
+	return PriceQuote{price, EtherscanOracle, timestamp}, nil
+}
+
+// The block mined closest before a time, from Etherscan's block/getblocknobytime
+func (client EtherscanClient) BlockNumberAt(at time.Time) (uint64, error) {
+	url := apiUrl(map[string]string{
+		"module":    "block",
+		"action":    "getblocknobytime",
+		"timestamp": strconv.FormatInt(at.Unix(), 10),
+		"closest":   "before",
+		"apikey":    client.apiKey,
+	})
+
+	client.limiter.Wait()
+
+	responseBody, err := StrictGetRequest(url, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	var response GetBalanceResponse
+	json.Unmarshal(responseBody, &response)
+
+	if response.Message != "OK" {
+		return 0, fmt.Errorf("etherscan api response error: %s", response.Result)
+	}
+
+	return strconv.ParseUint(response.Result, 10, 64)
+}
+
+// The aggregator's latest round as of the block
+func (oracle ChainlinkPriceOracle) ETHUSDPriceAt(at PointInTime) (PriceQuote, error) {
+	block := new(big.Int).SetUint64(at.Block)
+
+	decimals, err := oracle.callAt(decimalsSelector, block)
+	if err != nil {
+		return PriceQuote{}, err
+	}
+
+	round, err := oracle.callAt(latestRoundDataSelector, block)
+	if err != nil {
+		return PriceQuote{}, err
+	}
+
+	if len(decimals) < 32 || len(round) < 5*32 {
+		return PriceQuote{}, errors.New("unexpected response from the Chainlink aggregator")
+	}
+
+	return chainlinkQuote(new(big.Int).SetBytes(decimals[:32]), round)
+}
+
+func (oracle ChainlinkPriceOracle) callAt(data []byte, block *big.Int) ([]byte, error) {
+	oracle.limiter.Wait()
+
+	return oracle.client.CallContract(context.Background(), ethereum.CallMsg{To: &oracle.aggregator, Data: data}, block)
+}
+
+func (oracle StaticPriceOracle) ETHUSDPriceAt(at PointInTime) (PriceQuote, error) {
+	return PriceQuote{oracle.price, StaticOracle, at.Date}, nil
+}
+
+// A local price history with a date and a price on each row, e.g. an export from
+// a price site. Rows needn't be sorted. A header row is skipped if present.
+//
+//	date,price
+//	2021-11-09,4808.38
+type CSVPriceHistory struct {
+	path string
+}
+
+// Uses the latest row on or before the date, so gaps in the history are filled
+// with the previous day's price
+func (history CSVPriceHistory) ETHUSDPriceAt(at PointInTime) (PriceQuote, error) {
+	file, err := os.Open(history.path)
+	if err != nil {
+		return PriceQuote{}, err
+	}
+
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+
+	var best PriceQuote
+
+	for line := 1; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return PriceQuote{}, fmt.Errorf("%s line %d: %w", history.path, line, err)
+		}
+
+		if len(row) < 2 {
+			continue
+		}
+
+		date, err := time.Parse(DateFormat, strings.TrimSpace(row[0]))
+		if err != nil {
+			if line == 1 {
+				continue // Header
+			}
+
+			return PriceQuote{}, fmt.Errorf("%s line %d: %w", history.path, line, err)
+		}
+
+		if date.After(at.Date) || (best.Price != nil && !date.After(best.Timestamp)) {
+			continue
+		}
+
+		price, err := parseDecimal(row[1])
+		if err != nil {
+			return PriceQuote{}, fmt.Errorf("%s line %d: %w", history.path, line, err)
+		}
+
+		best = PriceQuote{price, CSVOracle, date}
+	}
+
+	if best.Price == nil {
+		return PriceQuote{}, fmt.Errorf("%s has no price on or before %s", history.path, at.Date.Format(DateFormat))
+	}
+
+	return best, nil
+}
+
+// Resolve --at-block or --at-date into both a block and its day
+func (app App) ResolvePointInTime(block uint64, date string) (PointInTime, error) {
+	if date != "" {
+		day, err := time.Parse(DateFormat, date)
+		if err != nil {
+			return PointInTime{}, fmt.Errorf("--at-date: %w", err)
+		}
+
+		// The state at the end of that day
+		block, err := app.etherscan.BlockNumberAt(day.Add(24*time.Hour - time.Second))
+		if err != nil {
+			return PointInTime{}, err
+		}
+
+		return PointInTime{block, day.UTC()}, nil
+	}
+
+	timestamp, err := app.ens.BlockTime(block)
+	if err != nil {
+		return PointInTime{}, err
+	}
+
+	return PointInTime{block, timestamp.UTC().Truncate(24 * time.Hour)}, nil
+}
+
+func (client ENSClient) BlockTime(block uint64) (time.Time, error) {
+	client.limiter.Wait()
+
+	header, err := client.client.HeaderByNumber(context.Background(), new(big.Int).SetUint64(block))
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Unix(int64(header.Time), 0), nil
+}
+
+// Cacheable subject for an address's balance at a block
+type BalanceAtBlock struct {
+	address ETHAddress
+	block   uint64
+}
+
+func (subject BalanceAtBlock) CacheKey() string {
+	return fmt.Sprintf("%s.balance.%d", subject.address, subject.block)
+}
+
+// Balances at past blocks come from the node, which needs archive data (Infura has
+// it). Etherscan's free API only serves the latest balance.
+func (client ENSClient) CachedBalanceAt(cache Cache, address ETHAddress, block uint64) (*big.Int, error) {
+	data, err := WithRawCache(cache, BalanceAtBlock{address, block}, func() ([]byte, error) {
+		client.limiter.Wait()
+
+		balance, err := client.client.BalanceAt(context.Background(), common.HexToAddress(string(address)), new(big.Int).SetUint64(block))
+		if err != nil {
+			return nil, err
+		}
+
+		return []byte(balance.String()), nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return parseWei(string(data))
+}
@@ -1,15 +1,36 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 )
 
+// Returned by the strict request helpers when the upstream answers with an
+// unexpected status, so callers can react to specific codes like 429.
+type HTTPStatusError struct {
+	StatusCode int
+	Status     string
+	Url        string
+}
+
+func (err HTTPStatusError) Error() string {
+	return fmt.Sprintf("expected a 200 OK status code, but received %s while requesting %s", err.Status, err.Url)
+}
+
+func IsRateLimited(err error) bool {
+	var statusError HTTPStatusError
+
+	return errors.As(err, &statusError) && statusError.StatusCode == http.StatusTooManyRequests
+}
+
 // Finish constructing and submit a GET request, returning any error encountered
 // as well as returning an error if the response status is not 200 OK.
 func StrictGetRequest(url string, headers map[string]string) ([]byte, error) {
-	client := &http.Client{}
+	client := meteredHTTPClient
 
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
@@ -28,7 +49,7 @@ func StrictGetRequest(url string, headers map[string]string) ([]byte, error) {
 	defer response.Body.Close()
 
 	if response.StatusCode != 200 {
-		return nil, fmt.Errorf("expected a 200 OK status code, but received %s while requesting %s", response.Status, url)
+		return nil, HTTPStatusError{response.StatusCode, response.Status, url}
 	}
 
 	body, err := ioutil.ReadAll(response.Body)
@@ -38,3 +59,31 @@ func StrictGetRequest(url string, headers map[string]string) ([]byte, error) {
 
 	return body, nil
 }
+
+// POST a JSON body, returning an error if the response status is not 2xx. Used for
+// webhooks where receivers commonly answer with 200, 202, or 204.
+func StrictPostJSON(url string, payload interface{}) error {
+	_, err := StrictPostJSONRequest(url, payload)
+	return err
+}
+
+// Like StrictPostJSON, but also returns the response body
+func StrictPostJSONRequest(url string, payload interface{}) ([]byte, error) {
+	serialized, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := meteredHTTPClient.Post(url, "application/json", bytes.NewReader(serialized))
+	if err != nil {
+		return nil, err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return nil, HTTPStatusError{response.StatusCode, response.Status, url}
+	}
+
+	return ioutil.ReadAll(response.Body)
+}
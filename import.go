@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Building the user pool from files instead of the Twitter API. Two inputs are
+// supported and can be combined:
+//
+//   - An unzipped Twitter "Your archive" export. following.js and follower.js only
+//     carry account ids, so on their own they can't surface ENS names.
+//   - A CSV of profiles (id, username, name, description, url). Rows are matched to
+//     archive accounts by id, and rows without an archive match are added as-is.
+
+type ImportConfig struct {
+	ArchiveDir string `yaml:"archive_dir"` // Directory containing the archive's data/ folder
+	CSV        string `yaml:"csv"`
+	Followers  bool   `yaml:"followers"` // Also import follower.js from the archive
+}
+
+func (config ImportConfig) Enabled() bool {
+	return config.ArchiveDir != "" || config.CSV != ""
+}
+
+// Archive .js files are JSON arrays assigned to a global, e.g.
+// `window.YTD.following.part0 = [ ... ]`
+func readArchiveFile(archiveDir string, name string, entries interface{}) error {
+	var contents []byte
+	var err error
+
+	// Depending on how the zip was extracted, files are either under data/ or at the root
+	for _, candidate := range []string{filepath.Join(archiveDir, "data", name), filepath.Join(archiveDir, name)} {
+		contents, err = os.ReadFile(candidate)
+		if err == nil {
+			break
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("could not find %s in %s: %w", name, archiveDir, err)
+	}
+
+	assignment := bytes.IndexByte(contents, '=')
+	if assignment == -1 {
+		return fmt.Errorf("%s does not look like a Twitter archive file", name)
+	}
+
+	return json.Unmarshal(contents[assignment+1:], entries)
+}
+
+type archiveRelationship struct {
+	AccountId string `json:"accountId"`
+}
+
+type archiveAccount struct {
+	Account struct {
+		AccountId          string `json:"accountId"`
+		Username           string `json:"username"`
+		AccountDisplayName string `json:"accountDisplayName"`
+	} `json:"account"`
+}
+
+func loadArchiveRelationships(archiveDir string, kind string) ([]string, error) {
+	var entries []map[string]archiveRelationship
+
+	if err := readArchiveFile(archiveDir, kind+".js", &entries); err != nil {
+		return nil, err
+	}
+
+	ids := []string{}
+	for _, entry := range entries {
+		if relationship, isPresent := entry[kind]; isPresent && relationship.AccountId != "" {
+			ids = append(ids, relationship.AccountId)
+		}
+	}
+
+	return ids, nil
+}
+
+// Rows are keyed by header name so column order doesn't matter. "handle", "bio", and
+// "followers_count" are accepted as aliases for "username", "description", and
+// "followers". Repeated rows for the same username (or id, without one) are dropped
+// after the first.
+func loadProfileCSV(path string) ([]TwitterUser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("could not read header row of %s: %w", path, err)
+	}
+
+	columns := map[string]int{}
+	for index, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = index
+	}
+
+	for alias, name := range map[string]string{"handle": "username", "bio": "description", "followers_count": "followers"} {
+		if index, isPresent := columns[alias]; isPresent {
+			if _, hasName := columns[name]; !hasName {
+				columns[name] = index
+			}
+		}
+	}
+
+	if _, isPresent := columns["username"]; !isPresent {
+		if _, isPresent := columns["id"]; !isPresent {
+			return nil, fmt.Errorf("%s needs an id or username column", path)
+		}
+	}
+
+	users := []TwitterUser{}
+	seen := map[string]bool{}
+	duplicates := 0
+
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", path, line, err)
+		}
+
+		field := func(name string) string {
+			index, isPresent := columns[name]
+			if !isPresent || index >= len(row) {
+				return ""
+			}
+
+			return strings.TrimSpace(row[index])
+		}
+
+		user := TwitterUser{
+			Id:          field("id"),
+			Username:    strings.TrimPrefix(field("username"), "@"),
+			Name:        field("name"),
+			Description: field("description"),
+		}
+
+		if url := field("url"); url != "" {
+			user.Url = &url
+		}
+
+		if followers, err := strconv.Atoi(field("followers")); err == nil {
+			user.PublicMetrics = &TwitterPublicMetrics{FollowersCount: followers}
+		}
+
+		if user.Id == "" && user.Username == "" {
+			continue // Blank row
+		}
+
+		key := "id:" + user.Id
+		if user.Username != "" {
+			key = "username:" + strings.ToLower(user.Username)
+		}
+
+		if seen[key] {
+			duplicates++
+			continue
+		}
+
+		seen[key] = true
+
+		// Without an id we still need something unique to key the user on
+		if user.Id == "" {
+			user.Id = "csv:" + strings.ToLower(user.Username)
+		}
+
+		users = append(users, user)
+	}
+
+	if duplicates > 0 {
+		logger.Warn("Ignored %d repeated rows in %s", duplicates, path)
+	}
+
+	return users, nil
+}
+
+func LoadImportedPool(config ImportConfig) ([]TwitterUser, SeedProvenance, error) {
+	pool := []TwitterUser{}
+	provenance := SeedProvenance{}
+	profiles := map[string]TwitterUser{}
+	csvUsers := []TwitterUser{}
+
+	if config.CSV != "" {
+		users, err := loadProfileCSV(config.CSV)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, user := range users {
+			profiles[user.Id] = user
+		}
+
+		csvUsers = users
+	}
+
+	matched := map[string]bool{}
+
+	if config.ArchiveDir != "" {
+		var accounts []archiveAccount
+		if err := readArchiveFile(config.ArchiveDir, "account.js", &accounts); err != nil {
+			return nil, nil, err
+		}
+
+		owner := "archive"
+		if len(accounts) > 0 && accounts[0].Account.Username != "" {
+			owner = accounts[0].Account.Username
+		}
+
+		kinds := []string{"following"}
+		if config.Followers {
+			kinds = append(kinds, "follower")
+		}
+
+		for _, kind := range kinds {
+			ids, err := loadArchiveRelationships(config.ArchiveDir, kind)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			label := fmt.Sprintf("%s (%s)", owner, kind)
+
+			for _, id := range ids {
+				user, isPresent := profiles[id]
+				if isPresent {
+					matched[id] = true
+				} else {
+					user = TwitterUser{Id: id}
+				}
+
+				if len(provenance[id]) == 0 {
+					pool = append(pool, user)
+				}
+
+				if !containsString(provenance[id], label) {
+					provenance[id] = append(provenance[id], label)
+				}
+			}
+
+			logger.Debug("Imported %d accounts from %s.js\n", len(ids), kind)
+		}
+	}
+
+	for _, user := range csvUsers {
+		if !matched[user.Id] && !containsString(provenance[user.Id], "csv") {
+			pool = append(pool, user)
+			provenance[user.Id] = append(provenance[user.Id], "csv")
+		}
+	}
+
+	missingProfiles := 0
+	for _, user := range pool {
+		if user.Username == "" {
+			missingProfiles++
+		}
+	}
+
+	if missingProfiles > 0 {
+		logger.Warn(
+			"%d imported accounts have no profile data, so ENS names can't be found for them. Add their bios with import.csv",
+			missingProfiles,
+		)
+	}
+
+	return pool, provenance, nil
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// A step in turning the full report into the leaderboard we show: a filter, a
+// sort, or a cut-off. Steps compose in order, so every output format sees the same
+// list.
+type LeaderboardOption func(reports []UserENSReport) []UserENSReport
+
+type LeaderboardFilter func(userReport UserENSReport) bool
+
+func ApplyLeaderboardOptions(reports []UserENSReport, options ...LeaderboardOption) []UserENSReport {
+	for _, option := range options {
+		reports = option(reports)
+	}
+
+	return reports
+}
+
+// Keep only the users every filter accepts
+func Where(filters ...LeaderboardFilter) LeaderboardOption {
+	return func(reports []UserENSReport) []UserENSReport {
+		kept := []UserENSReport{}
+
+	nextUser:
+		for _, userReport := range reports {
+			for _, filter := range filters {
+				if !filter(userReport) {
+					continue nextUser
+				}
+			}
+
+			kept = append(kept, userReport)
+		}
+
+		return kept
+	}
+}
+
+func MinETH(min *big.Rat) LeaderboardFilter {
+	minWei := ethToWei(min)
+
+	return func(userReport UserENSReport) bool {
+		return userReport.ensReportList.totalWei().Cmp(minWei) >= 0
+	}
+}
+
+func MinUSD(min *big.Rat, ethPrice *big.Rat) LeaderboardFilter {
+	return func(userReport UserENSReport) bool {
+		return userReport.ensReportList.totalUSD(ethPrice).Cmp(min) >= 0
+	}
+}
+
+func MinSeeds(min int) LeaderboardFilter {
+	return func(userReport UserENSReport) bool {
+		return len(userReport.followedBy) >= min
+	}
+}
+
+func MinFollowers(min int) LeaderboardFilter {
+	return func(userReport UserENSReport) bool {
+		return userReport.user.FollowersCount() >= min
+	}
+}
+
+func OnlyVerified() LeaderboardFilter {
+	return func(userReport UserENSReport) bool {
+		return userReport.user.Verified
+	}
+}
+
+// Users with at least one name ending in the suffix. "eth" and ".eth" are the same,
+// and a whole name like "cb.id" matches its subdomains.
+func HasDomainSuffix(suffix string) LeaderboardFilter {
+	suffix = "." + strings.ToLower(strings.TrimPrefix(suffix, "."))
+
+	return func(userReport UserENSReport) bool {
+		for _, report := range userReport.ensReportList.reports {
+			if strings.HasSuffix("."+string(report.domain), suffix) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+// What the leaderboard can be sorted by. Everything except name sorts from
+// highest to lowest.
+//
+// There is deliberately no tokens sort yet. Only ETH balances are fetched, so it
+// is deferred until ERC-20 balances are tracked rather than offered as a flag that
+// always fails.
+type SortKey string
+
+const (
+	SortByETH       SortKey = "eth"
+	SortByUSD       SortKey = "usd"
+	SortByFollowers SortKey = "followers"
+	SortByDomains   SortKey = "domains"
+	SortByName      SortKey = "name"
+	SortByInfluence SortKey = "influence" // ETH per follower
+)
+
+var sortKeys = []SortKey{SortByETH, SortByUSD, SortByFollowers, SortByDomains, SortByName, SortByInfluence}
+
+func (key SortKey) Validate() error {
+	for _, known := range sortKeys {
+		if key == known {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown sort %q (expected eth, usd, followers, domains, name, or influence)", key)
+}
+
+// A stable sort, so users that tie keep their previous order
+func SortBy(key SortKey) LeaderboardOption {
+	return func(reports []UserENSReport) []UserENSReport {
+		sorted := append([]UserENSReport{}, reports...)
+
+		var less func(a UserENSReport, b UserENSReport) bool
+
+		switch key {
+		case SortByETH, SortByUSD:
+			// USD is ETH times a single price, so the order is the same
+			less = hasMoreETH
+		case SortByFollowers:
+			less = func(a UserENSReport, b UserENSReport) bool {
+				return a.user.FollowersCount() > b.user.FollowersCount()
+			}
+		case SortByDomains:
+			less = func(a UserENSReport, b UserENSReport) bool {
+				return a.ensReportList.domainCount() > b.ensReportList.domainCount()
+			}
+		case SortByName:
+			less = func(a UserENSReport, b UserENSReport) bool {
+				return strings.ToLower(a.user.Username) < strings.ToLower(b.user.Username)
+			}
+		case SortByInfluence:
+			less = func(a UserENSReport, b UserENSReport) bool {
+				return a.ethPerFollower() > b.ethPerFollower()
+			}
+		default:
+			return sorted
+		}
+
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return less(sorted[i], sorted[j])
+		})
+
+		return sorted
+	}
+}
+
+func Top(count int) LeaderboardOption {
+	return func(reports []UserENSReport) []UserENSReport {
+		if count > 0 && len(reports) > count {
+			return reports[:count]
+		}
+
+		return reports
+	}
+}
+
+// The filters, sort, and cut-off the config asks for, in that order
+func LeaderboardOptions(config Config, ethPrice *big.Rat) []LeaderboardOption {
+	filters := config.Filters
+
+	conditions := []LeaderboardFilter{MinETH(floatToDecimal(filters.MinETH)), MinSeeds(filters.MinSeeds), MinFollowers(filters.MinFollowers)}
+
+	if filters.MinUSD > 0 {
+		conditions = append(conditions, MinUSD(floatToDecimal(filters.MinUSD), ethPrice))
+	}
+
+	if filters.OnlyVerified {
+		conditions = append(conditions, OnlyVerified())
+	}
+
+	if filters.DomainSuffix != "" {
+		conditions = append(conditions, HasDomainSuffix(filters.DomainSuffix))
+	}
+
+	options := []LeaderboardOption{Where(conditions...)}
+
+	if config.Output.Sort != "" {
+		options = append(options, SortBy(config.Output.Sort))
+	}
+
+	return append(options, Top(filters.Top))
+}
+
+// Command line overrides for the leaderboard section of the config, shared by
+// every command that prints a leaderboard
+type LeaderboardFlags struct {
+	flags        *flag.FlagSet
+	minETH       *float64
+	minUSD       *float64
+	top          *int
+	onlyVerified *bool
+	domainSuffix *string
+	sort         *string
+	currency     *string
+}
+
+func NewLeaderboardFlags(flags *flag.FlagSet) LeaderboardFlags {
+	return LeaderboardFlags{
+		flags,
+		flags.Float64("min-eth", 0, "Only show users with at least this much ETH"),
+		flags.Float64("min-usd", 0, "Only show users with at least this much USD"),
+		flags.Int("top", 0, "Only show the top N users (0 shows everyone)"),
+		flags.Bool("only-verified", false, "Only show verified accounts"),
+		flags.String("has-domain-suffix", "", "Only show users with a name ending in this, e.g. .eth"),
+		flags.String("sort", "", "Sort by eth, usd, followers, domains, name, or influence"),
+		flags.String("currency", "", "Show balances in usd, eur, gbp, or jpy"),
+	}
+}
+
+// Copy any flags that were given over the config. Call after parsing.
+func (leaderboardFlags LeaderboardFlags) Apply(config *Config) {
+	leaderboardFlags.flags.Visit(func(given *flag.Flag) {
+		switch given.Name {
+		case "min-eth":
+			config.Filters.MinETH = *leaderboardFlags.minETH
+		case "min-usd":
+			config.Filters.MinUSD = *leaderboardFlags.minUSD
+		case "top":
+			config.Filters.Top = *leaderboardFlags.top
+		case "only-verified":
+			config.Filters.OnlyVerified = *leaderboardFlags.onlyVerified
+		case "has-domain-suffix":
+			config.Filters.DomainSuffix = *leaderboardFlags.domainSuffix
+		case "sort":
+			config.Output.Sort = SortKey(*leaderboardFlags.sort)
+		case "currency":
+			config.Price.Currency = Currency(strings.ToLower(*leaderboardFlags.currency))
+		}
+	})
+}
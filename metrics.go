@@ -0,0 +1,324 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics live in memory for the life of the process. serve and watch expose them
+// on /metrics in the Prometheus text format, which is simple enough to write by
+// hand; other commands print a summary when they finish.
+
+var (
+	upstreamRequests = NewCounterVec(
+		"flex_upstream_requests_total", "HTTP requests to Twitter, Infura, Etherscan, and other upstreams.", "host", "status",
+	)
+	upstreamRequestDuration = NewHistogramVec(
+		"flex_upstream_request_duration_seconds", "Time spent waiting on upstream HTTP requests.",
+		[]float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}, "host",
+	)
+	cacheLookups = NewCounterVec(
+		"flex_cache_lookups_total", "Cache lookups by namespace and whether they hit.", "namespace", "result",
+	)
+	ensResolutionFailures = NewCounterVec(
+		"flex_ens_resolution_failures_total", "ENS names that don't resolve and are now ignored, by reason.", "reason",
+	)
+	ensTransientFailures = NewCounterVec(
+		"flex_ens_transient_failures_total", "ENS lookups that failed but will be retried, by reason.", "reason",
+	)
+	buildReportDuration = NewHistogramVec(
+		"flex_build_report_duration_seconds", "Time taken to resolve names and fetch balances for the user pool.",
+		[]float64{1, 5, 15, 30, 60, 120, 300, 600, 1800},
+	)
+)
+
+var allMetrics = []Metric{upstreamRequests, upstreamRequestDuration, cacheLookups, ensResolutionFailures, ensTransientFailures, buildReportDuration}
+
+type Metric interface {
+	WriteExposition(writer io.Writer)
+}
+
+// One set of label values and what was recorded for it
+type metricSeries struct {
+	labels []string
+	value  float64  // Counters
+	counts []uint64 // Histograms, one per bucket (not cumulative)
+	sum    float64  // Histograms
+	count  uint64   // Histograms
+}
+
+type metricSeriesMap struct {
+	mutex  *sync.Mutex
+	series map[string]*metricSeries
+}
+
+func newMetricSeriesMap() metricSeriesMap {
+	return metricSeriesMap{&sync.Mutex{}, map[string]*metricSeries{}}
+}
+
+// Run update on the series for these label values, creating it if needed
+func (seriesMap metricSeriesMap) update(labels []string, update func(series *metricSeries)) {
+	seriesMap.mutex.Lock()
+	defer seriesMap.mutex.Unlock()
+
+	key := strings.Join(labels, "\x00")
+
+	series, isPresent := seriesMap.series[key]
+	if !isPresent {
+		series = &metricSeries{labels: labels}
+		seriesMap.series[key] = series
+	}
+
+	update(series)
+}
+
+// Copies of every series, ordered by label values
+func (seriesMap metricSeriesMap) sorted() []metricSeries {
+	seriesMap.mutex.Lock()
+	defer seriesMap.mutex.Unlock()
+
+	keys := []string{}
+	for key := range seriesMap.series {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	sorted := []metricSeries{}
+	for _, key := range keys {
+		series := *seriesMap.series[key]
+		series.counts = append([]uint64{}, series.counts...)
+		sorted = append(sorted, series)
+	}
+
+	return sorted
+}
+
+type CounterVec struct {
+	name   string
+	help   string
+	labels []string
+	series metricSeriesMap
+}
+
+func NewCounterVec(name string, help string, labels ...string) CounterVec {
+	return CounterVec{name, help, labels, newMetricSeriesMap()}
+}
+
+func (counter CounterVec) Inc(labels ...string) {
+	counter.series.update(labels, func(series *metricSeries) {
+		series.value++
+	})
+}
+
+func (counter CounterVec) WriteExposition(writer io.Writer) {
+	fmt.Fprintf(writer, "# HELP %s %s\n# TYPE %s counter\n", counter.name, counter.help, counter.name)
+
+	for _, series := range counter.series.sorted() {
+		fmt.Fprintf(writer, "%s%s %s\n", counter.name, formatLabels(counter.labels, series.labels, ""), formatSample(series.value))
+	}
+}
+
+type HistogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64 // Upper bounds, ascending, without +Inf
+	series  metricSeriesMap
+}
+
+func NewHistogramVec(name string, help string, buckets []float64, labels ...string) HistogramVec {
+	return HistogramVec{name, help, labels, buckets, newMetricSeriesMap()}
+}
+
+func (histogram HistogramVec) Observe(value float64, labels ...string) {
+	histogram.series.update(labels, func(series *metricSeries) {
+		if series.counts == nil {
+			series.counts = make([]uint64, len(histogram.buckets))
+		}
+
+		for index, bound := range histogram.buckets {
+			if value <= bound {
+				series.counts[index]++
+				break
+			}
+		}
+
+		series.sum += value
+		series.count++
+	})
+}
+
+// Observe the time since start, in seconds. Meant for defer, where start is
+// evaluated straight away.
+func (histogram HistogramVec) ObserveDuration(start time.Time, labels ...string) {
+	histogram.Observe(time.Since(start).Seconds(), labels...)
+}
+
+func (histogram HistogramVec) WriteExposition(writer io.Writer) {
+	fmt.Fprintf(writer, "# HELP %s %s\n# TYPE %s histogram\n", histogram.name, histogram.help, histogram.name)
+
+	for _, series := range histogram.series.sorted() {
+		var cumulative uint64
+
+		for index, bound := range histogram.buckets {
+			cumulative += series.counts[index]
+			le := formatLabels(histogram.labels, series.labels, formatSample(bound))
+			fmt.Fprintf(writer, "%s_bucket%s %d\n", histogram.name, le, cumulative)
+		}
+
+		labels := formatLabels(histogram.labels, series.labels, "")
+		fmt.Fprintf(writer, "%s_bucket%s %d\n", histogram.name, formatLabels(histogram.labels, series.labels, "+Inf"), series.count)
+		fmt.Fprintf(writer, "%s_sum%s %s\n", histogram.name, labels, formatSample(series.sum))
+		fmt.Fprintf(writer, "%s_count%s %d\n", histogram.name, labels, series.count)
+	}
+}
+
+// {name="value",...}, with an le label appended for histogram buckets
+func formatLabels(names []string, values []string, le string) string {
+	pairs := []string{}
+
+	for index, name := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", name, strconv.Quote(values[index])))
+	}
+
+	if le != "" {
+		pairs = append(pairs, fmt.Sprintf("le=%q", le))
+	}
+
+	if len(pairs) == 0 {
+		return ""
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatSample(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func WriteMetrics(writer io.Writer) {
+	for _, metric := range allMetrics {
+		metric.WriteExposition(writer)
+	}
+}
+
+func metricsHandler(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	WriteMetrics(writer)
+}
+
+// Listen on addr with only /metrics, for commands that don't already serve HTTP
+func ServeMetrics(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", metricsHandler)
+
+	logger.Info("Serving metrics on %s/metrics", addr)
+
+	go func() {
+		err := http.ListenAndServe(addr, mux)
+		logger.Error("Metrics server stopped: %s", err)
+	}()
+}
+
+// Wraps a transport to count and time every request by host. Shared by the strict
+// request helpers and the Ethereum RPC client.
+type MeteredTransport struct {
+	transport http.RoundTripper
+}
+
+var meteredHTTPClient = &http.Client{Transport: MeteredTransport{http.DefaultTransport}}
+
+func (metered MeteredTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	host := request.URL.Host
+	defer upstreamRequestDuration.ObserveDuration(time.Now(), host)
+
+	response, err := metered.transport.RoundTrip(request)
+	if err != nil {
+		upstreamRequests.Inc(host, "error")
+		return nil, err
+	}
+
+	upstreamRequests.Inc(host, strconv.Itoa(response.StatusCode))
+
+	return response, nil
+}
+
+// Where a run's time and requests went, e.g.
+//
+//	api.twitter.com    42 requests (200: 41, 429: 1), 12.3s
+func WriteMetricsSummary(writer io.Writer) {
+	requests := upstreamRequests.series.sorted()
+	durations := upstreamRequestDuration.series.sorted()
+	lookups := cacheLookups.series.sorted()
+	failures := ensResolutionFailures.series.sorted()
+	transients := ensTransientFailures.series.sorted()
+	reports := buildReportDuration.series.sorted()
+
+	if len(requests)+len(lookups)+len(failures)+len(transients)+len(reports) == 0 {
+		return
+	}
+
+	fmt.Fprintf(writer, "\nMetrics\n")
+
+	for _, duration := range durations {
+		host := duration.labels[0]
+		statuses := []string{}
+
+		for _, request := range requests {
+			if request.labels[0] == host {
+				statuses = append(statuses, fmt.Sprintf("%s: %s", request.labels[1], formatSample(request.value)))
+			}
+		}
+
+		fmt.Fprintf(writer, "  %-30s %d requests (%s), %.1fs\n", host, duration.count, strings.Join(statuses, ", "), duration.sum)
+	}
+
+	hits := map[string]float64{}
+	misses := map[string]float64{}
+	namespaces := []string{}
+
+	for _, lookup := range lookups {
+		namespace := lookup.labels[0]
+		if hits[namespace]+misses[namespace] == 0 {
+			namespaces = append(namespaces, namespace)
+		}
+
+		if lookup.labels[1] == "hit" {
+			hits[namespace] += lookup.value
+		} else {
+			misses[namespace] += lookup.value
+		}
+	}
+
+	for _, namespace := range namespaces {
+		total := hits[namespace] + misses[namespace]
+		fmt.Fprintf(
+			writer, "  %-30s %s hits, %s misses (%.0f%% hit rate)\n",
+			namespace+" cache", formatSample(hits[namespace]), formatSample(misses[namespace]), 100*hits[namespace]/total,
+		)
+	}
+
+	for _, failure := range failures {
+		fmt.Fprintf(writer, "  %-30s %s\n", "ENS failures ("+failure.labels[0]+")", formatSample(failure.value))
+	}
+
+	for _, transient := range transients {
+		fmt.Fprintf(writer, "  %-30s %s\n", "ENS retries ("+transient.labels[0]+")", formatSample(transient.value))
+	}
+
+	for _, report := range reports {
+		fmt.Fprintf(writer, "  %-30s %.1fs\n", "Report built in", report.sum)
+	}
+}
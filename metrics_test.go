@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteExposition(t *testing.T) {
+	tests := []struct {
+		name     string
+		metric   func() Metric
+		expected string
+	}{
+		{
+			"counter",
+			func() Metric {
+				counter := NewCounterVec("test_requests_total", "Requests by host and status.", "host", "status")
+				counter.Inc("b.example", "200")
+				counter.Inc("a.example", "500")
+				counter.Inc("a.example", "200")
+				counter.Inc("a.example", "200")
+				return counter
+			},
+			`# HELP test_requests_total Requests by host and status.
+# TYPE test_requests_total counter
+test_requests_total{host="a.example",status="200"} 2
+test_requests_total{host="a.example",status="500"} 1
+test_requests_total{host="b.example",status="200"} 1
+`,
+		},
+		{
+			"histogram",
+			func() Metric {
+				histogram := NewHistogramVec("test_duration_seconds", "Request durations.", []float64{0.1, 1}, "host")
+				histogram.Observe(0.05, "a.example")
+				histogram.Observe(0.5, "a.example")
+				histogram.Observe(1, "a.example")
+				histogram.Observe(2.5, "a.example")
+				return histogram
+			},
+			`# HELP test_duration_seconds Request durations.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{host="a.example",le="0.1"} 1
+test_duration_seconds_bucket{host="a.example",le="1"} 3
+test_duration_seconds_bucket{host="a.example",le="+Inf"} 4
+test_duration_seconds_sum{host="a.example"} 4.05
+test_duration_seconds_count{host="a.example"} 4
+`,
+		},
+		{
+			"unlabelled histogram",
+			func() Metric {
+				histogram := NewHistogramVec("test_build_seconds", "Build time.", []float64{60})
+				histogram.Observe(90)
+				return histogram
+			},
+			`# HELP test_build_seconds Build time.
+# TYPE test_build_seconds histogram
+test_build_seconds_bucket{le="60"} 0
+test_build_seconds_bucket{le="+Inf"} 1
+test_build_seconds_sum 90
+test_build_seconds_count 1
+`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var output bytes.Buffer
+			test.metric().WriteExposition(&output)
+
+			if output.String() != test.expected {
+				t.Errorf("expected\n%s\ngot\n%s", test.expected, output.String())
+			}
+		})
+	}
+}
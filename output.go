@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// ethPrice is per ETH in the given currency
+func PrintLeaderboard(sortedResults []UserENSReport, ethPrice *big.Rat, currency Currency) {
+	heading := fmt.Sprintf(
+		"| %-16s | %-50s | %11s | %15s | %5s | %10s | %-8s | %4s |\n",
+		"Twitter handle", "ENS Domain", "ETH Balance", currency.Code()+" Balance", "Seeds", "Followers", "Verified", "Age",
+	)
+	fmt.Printf(heading)
+	fmt.Printf("%s\n", strings.Repeat("-", len(heading)))
+
+	now := time.Now()
+
+	for _, userReport := range sortedResults {
+		fmt.Printf(
+			"| @%-15s | %-50s | %11s | %s%14s | %5d | %10s | %-8s | %4s |\n",
+			userReport.user.Username,
+			strings.Join(userReport.ensReportList.domains(), ", "),
+			displayETH(userReport.ensReportList.totalWei(), 2),
+			currency.Symbol(),
+			displayMoney(weiValue(userReport.ensReportList.totalWei(), ethPrice), currency),
+			len(userReport.followedBy),
+			displayFollowers(userReport.user),
+			displayVerified(userReport.user),
+			displayAge(userReport.user.AccountAge(now)),
+		)
+	}
+}
+
+func PrintRunList(snapshots []RunSnapshot) {
+	heading := fmt.Sprintf("| %-23s | %-20s | %10s | %10s | %6s |\n", "Run", "Timestamp", "Block", "ETH/USD", "Users")
+	fmt.Printf(heading)
+	fmt.Printf("%s\n", strings.Repeat("-", len(heading)))
+
+	for _, snapshot := range snapshots {
+		fmt.Printf(
+			"| %-23s | %-20s | %10d | %10s | %6d |\n",
+			snapshot.Id,
+			snapshot.Timestamp.Format("2006-01-02 15:04:05"),
+			snapshot.BlockNumber,
+			displayFiat(snapshot.Price()),
+			len(snapshot.Users),
+		)
+	}
+}
+
+func PrintBalanceHistory(username string, snapshots []RunSnapshot) {
+	fmt.Printf("Balance history for @%s\n\n", username)
+
+	heading := fmt.Sprintf("| %-23s | %10s | %11s | %15s | %-50s |\n", "Run", "Block", "ETH Balance", "USD Balance", "ENS Domain")
+	fmt.Printf(heading)
+	fmt.Printf("%s\n", strings.Repeat("-", len(heading)))
+
+	for _, snapshot := range snapshots {
+		userReport, isPresent := snapshot.FindUser(username)
+
+		if !isPresent {
+			fmt.Printf("| %-23s | %10d | %11s | %15s | %-50s |\n", snapshot.Id, snapshot.BlockNumber, "-", "-", "(not in pool)")
+			continue
+		}
+
+		fmt.Printf(
+			"| %-23s | %10d | %11s | $%14s | %-50s |\n",
+			snapshot.Id,
+			snapshot.BlockNumber,
+			displayETH(userReport.ensReportList.totalWei(), 2),
+			displayFiat(userReport.ensReportList.totalUSD(snapshot.Price())),
+			strings.Join(userReport.ensReportList.domains(), ", "),
+		)
+	}
+}
+
+func PrintRunDiff(diff RunDiff) {
+	fmt.Printf("Comparing run %s to run %s\n\n", diff.From, diff.To)
+
+	fmt.Printf("Biggest movers\n\n")
+	heading := fmt.Sprintf("| %-16s | %11s | %11s | %11s | %10s |\n", "Twitter handle", "Before", "After", "Change", "Pct Change")
+	fmt.Printf(heading)
+	fmt.Printf("%s\n", strings.Repeat("-", len(heading)))
+
+	for _, move := range diff.Movers {
+		percent := "n/a"
+		if move.PercentChange != nil {
+			percent = fmt.Sprintf("%+.1f%%", *move.PercentChange)
+		}
+
+		change := displayETH(move.change, 2)
+		if move.change.Sign() > 0 {
+			change = "+" + change
+		}
+
+		fmt.Printf("| @%-15s | %11s | %11s | %11s | %10s |\n", move.Username, displayETH(move.before, 2), displayETH(move.after, 2), change, percent)
+	}
+
+	fmt.Printf("\nENS names added or removed\n\n")
+	heading = fmt.Sprintf("| %-16s | %-40s | %-40s |\n", "Twitter handle", "Added", "Removed")
+	fmt.Printf(heading)
+	fmt.Printf("%s\n", strings.Repeat("-", len(heading)))
+
+	for _, change := range diff.DomainChanges {
+		fmt.Printf("| @%-15s | %-40s | %-40s |\n", change.Username, joinDomains(change.Added), joinDomains(change.Removed))
+	}
+
+	fmt.Printf("\nResolution changes\n\n")
+	heading = fmt.Sprintf("| %-30s | %-17s | %-42s | %-42s |\n", "ENS Domain", "Change", "Before", "After")
+	fmt.Printf(heading)
+	fmt.Printf("%s\n", strings.Repeat("-", len(heading)))
+
+	for _, change := range diff.ResolutionChanges {
+		fmt.Printf("| %-30s | %-17s | %-42s | %-42s |\n", change.Domain, change.Kind, displayAddress(change.Before), displayAddress(change.After))
+	}
+
+	fmt.Printf("\nRank changes\n\n")
+	heading = fmt.Sprintf("| %-16s | %6s | %6s |\n", "Twitter handle", "Before", "After")
+	fmt.Printf(heading)
+	fmt.Printf("%s\n", strings.Repeat("-", len(heading)))
+
+	for _, change := range diff.RankChanges {
+		fmt.Printf("| @%-15s | %6s | %6s |\n", change.Username, displayRank(change.Before), displayRank(change.After))
+	}
+}
+
+func PrintConflicts(conflicts []Conflict) {
+	heading := fmt.Sprintf("| %-7s | %-42s | %-50s |\n", "Kind", "Claimed", "Twitter handles")
+	fmt.Printf(heading)
+	fmt.Printf("%s\n", strings.Repeat("-", len(heading)))
+
+	for _, conflict := range conflicts {
+		fmt.Printf("| %-7s | %-42s | %-50s |\n", conflict.Kind, conflict.Subject, "@"+strings.Join(conflict.Usernames, ", @"))
+	}
+}
+
+func PrintJSON(value interface{}) {
+	serialized, err := json.MarshalIndent(value, "", "  ")
+	check(err)
+
+	fmt.Printf("%s\n", serialized)
+}
+
+func joinDomains(domains []ENSDomain) string {
+	names := []string{}
+
+	for _, domain := range domains {
+		names = append(names, string(domain))
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// Where the price used for a run came from, e.g. "ETH/USD 1,834.27 from chainlink
+// at 2026-01-02 15:04 UTC"
+func PrintPriceSource(snapshot RunSnapshot, ethPrice *big.Rat, currency Currency) {
+	source := snapshot.PriceSource
+	if source == "" {
+		source = "an unrecorded source"
+	}
+
+	line := fmt.Sprintf("ETH/%s %s from %s", currency.Code(), displayMoney(ethPrice, currency), source)
+
+	if snapshot.PriceTimestamp != nil {
+		line += " at " + snapshot.PriceTimestamp.UTC().Format("2006-01-02 15:04 MST")
+	}
+
+	if currency != USD {
+		line += fmt.Sprintf(" (converted from USD %s)", displayFiat(snapshot.Price()))
+	}
+
+	fmt.Printf("\n%s\n", line)
+}
+
+func displayFollowers(user TwitterUser) string {
+	if user.PublicMetrics == nil {
+		return "-"
+	}
+
+	return humanize.Comma(int64(user.FollowersCount()))
+}
+
+func displayVerified(user TwitterUser) string {
+	if user.Verified {
+		return "yes"
+	}
+
+	return ""
+}
+
+// Account age in whole years, e.g. "7y", or months for accounts under a year old
+func displayAge(age time.Duration) string {
+	if age <= 0 {
+		return "-"
+	}
+
+	days := int(age.Hours() / 24)
+	if days < 365 {
+		return fmt.Sprintf("%dm", days/30)
+	}
+
+	return fmt.Sprintf("%dy", days/365)
+}
+
+func displayAddress(address *ETHAddress) string {
+	if address == nil {
+		return "-"
+	}
+
+	return string(*address)
+}
+
+func displayRank(rank *int) string {
+	if rank == nil {
+		return "-"
+	}
+
+	return fmt.Sprintf("#%d", *rank)
+}
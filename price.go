@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// The price of one ETH in USD, where it came from, and when it was last updated
+type PriceQuote struct {
+	Price     *big.Rat
+	Source    string
+	Timestamp time.Time
+}
+
+type PriceOracle interface {
+	ETHUSDPrice() (PriceQuote, error)
+}
+
+const (
+	EtherscanOracle = "etherscan"
+	ChainlinkOracle = "chainlink"
+	StaticOracle    = "static"
+)
+
+// Mainnet ETH/USD price feed proxy
+const DefaultChainlinkAggregator = "0x5f4eC3Df9cbd43714FE2740f5E3616155c5b8419"
+
+func NewPriceOracle(config PriceConfig, etherscan EtherscanClient, ens ENSClient) (PriceOracle, error) {
+	switch config.Oracle {
+	case EtherscanOracle:
+		return etherscan, nil
+	case ChainlinkOracle:
+		return ChainlinkPriceOracle{ens.client, common.HexToAddress(config.ChainlinkAggregator), ens.limiter}, nil
+	case StaticOracle:
+		return NewStaticPriceOracle(config.StaticUSD)
+	default:
+		return nil, fmt.Errorf("unknown price oracle %q", config.Oracle)
+	}
+}
+
+// Reads the latest answer of a Chainlink aggregator with eth_call, so the price
+// comes from the same node as the resolutions
+type ChainlinkPriceOracle struct {
+	client     *ethclient.Client
+	aggregator common.Address
+	limiter    RateLimiter
+}
+
+var (
+	latestRoundDataSelector = selector("latestRoundData()")
+	decimalsSelector        = selector("decimals()")
+)
+
+func (oracle ChainlinkPriceOracle) ETHUSDPrice() (PriceQuote, error) {
+	decimals, err := oracle.call(decimalsSelector)
+	if err != nil {
+		return PriceQuote{}, err
+	}
+
+	// (uint80 roundId, int256 answer, uint256 startedAt, uint256 updatedAt, uint80 answeredInRound)
+	round, err := oracle.call(latestRoundDataSelector)
+	if err != nil {
+		return PriceQuote{}, err
+	}
+
+	if len(decimals) < 32 || len(round) < 5*32 {
+		return PriceQuote{}, errors.New("unexpected response from the Chainlink aggregator")
+	}
+
+	return chainlinkQuote(new(big.Int).SetBytes(decimals[:32]), round)
+}
+
+func chainlinkQuote(decimals *big.Int, round []byte) (PriceQuote, error) {
+	answer := new(big.Int).SetBytes(round[32:64])
+	if answer.Sign() <= 0 || round[32]&0x80 != 0 {
+		return PriceQuote{}, errors.New("the Chainlink aggregator has no positive answer")
+	}
+
+	scale := new(big.Int).Exp(big.NewInt(10), decimals, nil)
+	updatedAt := new(big.Int).SetBytes(round[96:128])
+
+	return PriceQuote{new(big.Rat).SetFrac(answer, scale), ChainlinkOracle, time.Unix(updatedAt.Int64(), 0).UTC()}, nil
+}
+
+func (oracle ChainlinkPriceOracle) call(data []byte) ([]byte, error) {
+	oracle.limiter.Wait()
+
+	return oracle.client.CallContract(context.Background(), ethereum.CallMsg{To: &oracle.aggregator, Data: data}, nil)
+}
+
+// A fixed price from the config, for offline runs and reproducible fixtures
+type StaticPriceOracle struct {
+	price *big.Rat
+}
+
+func NewStaticPriceOracle(price string) (StaticPriceOracle, error) {
+	parsed, err := parseDecimal(price)
+	if err != nil {
+		return StaticPriceOracle{}, err
+	}
+
+	return StaticPriceOracle{parsed}, nil
+}
+
+func (oracle StaticPriceOracle) ETHUSDPrice() (PriceQuote, error) {
+	return PriceQuote{oracle.price, StaticOracle, time.Now().UTC()}, nil
+}
+
+// A fiat currency the leaderboard can be shown in. Prices are always fetched in
+// USD and converted with the configured FX rates.
+type Currency string
+
+const USD Currency = "usd"
+
+var currencySymbols = map[Currency]string{"usd": "$", "eur": "€", "gbp": "£", "jpy": "¥"}
+
+// Yen have no minor unit in everyday use
+var currencyDecimals = map[Currency]int{"jpy": 0}
+
+func (currency Currency) Symbol() string {
+	return currencySymbols[currency]
+}
+
+func (currency Currency) Decimals() int {
+	if decimals, isPresent := currencyDecimals[currency]; isPresent {
+		return decimals
+	}
+
+	return FiatDecimals
+}
+
+func (currency Currency) Code() string {
+	return strings.ToUpper(string(currency))
+}
+
+// The ETH price in the currency, from the USD price and the configured rate of
+// currency units per dollar
+func (currency Currency) Convert(usdPrice *big.Rat, fxRates map[string]float64) (*big.Rat, error) {
+	if currency == USD {
+		return usdPrice, nil
+	}
+
+	rate, isPresent := fxRates[string(currency)]
+	if !isPresent {
+		return nil, fmt.Errorf("no FX rate configured for %s (set price.fx_rates.%s)", currency.Code(), currency)
+	}
+
+	return new(big.Rat).Mul(usdPrice, floatToDecimal(rate)), nil
+}
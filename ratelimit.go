@@ -0,0 +1,25 @@
+package main
+
+import "time"
+
+// Spaces out calls to an upstream API. Shared between goroutines, so concurrent
+// lookups still respect the provider's per-second limit.
+type RateLimiter struct {
+	ticks <-chan time.Time // Nil when unlimited
+}
+
+func NewRateLimiter(perSecond float64) RateLimiter {
+	if perSecond <= 0 {
+		return RateLimiter{}
+	}
+
+	interval := time.Duration(float64(time.Second) / perSecond)
+
+	return RateLimiter{time.Tick(interval)}
+}
+
+func (limiter RateLimiter) Wait() {
+	if limiter.ticks != nil {
+		<-limiter.ticks
+	}
+}
@@ -1,16 +1,78 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"math"
 	"math/big"
 	"sort"
+	"strings"
+	"sync"
+	"time"
 )
 
 type ENSReport struct {
-	domain  ENSDomain
-	valid   bool
-	address *ETHAddress
-	balance *big.Float // Denominated in ETH, not Wei
+	domain      ENSDomain // Empty for addresses posted directly instead of a name
+	valid       bool
+	address     *ETHAddress
+	balance     *big.Int         // In wei
+	reverseName ENSDomain        // Primary name of an address-only entry, if we looked it up
+	locations   []DomainLocation // Where in the profile the name was found
+	ownership   *Ownership       // Nil for address-only entries and runs from before classification
+	sharedWith  []string         // Other users claiming the same address, set by AttributeSharedBalances
+}
+
+// How the entry is shown in the leaderboard
+func (report ENSReport) label() string {
+	name := string(report.domain)
+	notes := []string{}
+
+	if report.domain == "" {
+		name = shortAddress(*report.address)
+
+		if report.reverseName != "" {
+			notes = append(notes, string(report.reverseName))
+		}
+	} else {
+		notes = append(notes, report.sources()...)
+
+		if report.ownership.isLikelyMention() {
+			notes = append(notes, "likely mention")
+		}
+	}
+
+	if len(report.sharedWith) > 0 {
+		notes = append(notes, "shared with @"+strings.Join(report.sharedWith, ", @"))
+	}
+
+	if len(notes) == 0 {
+		return name
+	}
+
+	return fmt.Sprintf("%s (%s)", name, strings.Join(notes, ", "))
+}
+
+// Distinct places the name was found, e.g. ["display name", "bio"]
+func (report ENSReport) sources() []string {
+	sources := []string{}
+	seen := map[DomainSource]bool{}
+
+	for _, location := range report.locations {
+		if !seen[location.Source] {
+			sources = append(sources, string(location.Source))
+			seen[location.Source] = true
+		}
+	}
+
+	return sources
+}
+
+func shortAddress(address ETHAddress) string {
+	if len(address) < 10 {
+		return string(address)
+	}
+
+	return fmt.Sprintf("%s...%s", address[:6], address[len(address)-4:])
 }
 
 type UserENSReportMap map[string][]ENSReport
@@ -18,93 +80,259 @@ type UserENSReportMap map[string][]ENSReport
 type UserENSReport struct {
 	user          TwitterUser
 	ensReportList ENSReportList
+	followedBy    []string // Seed usernames
 }
 
 type ENSReportList struct {
 	reports []ENSReport
 }
 
-func (reportList ENSReportList) totalBalance() float64 {
-	total := float64(0)
+// Exact total in wei across every valid entry. An address behind several of the
+// user's names is only counted once.
+func (reportList ENSReportList) totalWei() *big.Int {
+	total := new(big.Int)
+	counted := map[string]bool{}
 
 	for _, report := range reportList.reports {
-		if !report.valid {
+		if !report.valid || report.balance == nil {
 			continue
 		}
 
-		balance64, _ := report.balance.Float64()
-		total += balance64
+		if report.address != nil {
+			if counted[addressKey(*report.address)] {
+				continue
+			}
+
+			counted[addressKey(*report.address)] = true
+		}
+
+		total.Add(total, report.balance)
 	}
 
 	return total
 }
 
-func (reportList ENSReportList) totalBalanceUSD(ethPrice *big.Float) float64 {
-	price64, _ := ethPrice.Float64()
+func (reportList ENSReportList) totalUSD(ethPrice *big.Rat) *big.Rat {
+	return weiValue(reportList.totalWei(), ethPrice)
+}
+
+// Whether a holds more ETH than b, for sorting
+func hasMoreETH(a UserENSReport, b UserENSReport) bool {
+	return a.ensReportList.totalWei().Cmp(b.ensReportList.totalWei()) > 0
+}
+
+// Names only, not counting addresses posted directly
+func (reportList ENSReportList) domainCount() int {
+	count := 0
+
+	for _, report := range reportList.reports {
+		if report.domain != "" {
+			count++
+		}
+	}
 
-	return math.Round(reportList.totalBalance() * price64)
+	return count
 }
 
 func (reportList ENSReportList) domains() []string {
 	domains := []string{}
 
 	for _, report := range reportList.reports {
-		domains = append(domains, string(report.domain))
+		domains = append(domains, report.label())
 	}
 
 	return domains
 }
 
-func BuildReport(app App, users map[string]TwitterUser) UserENSReportMap {
+// Fails with the first balance lookup error, after letting the other workers
+// finish, so a flaky upstream fails the run instead of panicking a worker
+func BuildReport(app App, users map[string]TwitterUser) (UserENSReportMap, error) {
+	defer buildReportDuration.ObserveDuration(time.Now())
+
 	userReport := UserENSReportMap{}
 
-	for _, user := range users {
-		domains := user.ENSDomains()
+	type userResult struct {
+		userId  string
+		reports []ENSReport
+		err     error
+	}
+
+	pending := make(chan TwitterUser)
+	results := make(chan userResult)
+
+	var workers sync.WaitGroup
+
+	for i := 0; i < app.config.Concurrency.Lookups; i++ {
+		workers.Add(1)
+
+		go func() {
+			defer workers.Done()
+
+			for user := range pending {
+				reports, err := buildUserReport(app, user)
+				if err != nil {
+					err = fmt.Errorf("@%s: %w", user.Username, err)
+				}
 
-		if len(domains) == 0 {
+				results <- userResult{user.Id, reports, err}
+			}
+		}()
+	}
+
+	go func() {
+		for _, user := range users {
+			if len(user.ENSDomains()) > 0 || (app.config.Extract.Addresses && len(user.ETHAddresses()) > 0) {
+				pending <- user
+			}
+		}
+
+		close(pending)
+		workers.Wait()
+		close(results)
+	}()
+
+	var firstErr error
+
+	for result := range results {
+		if result.err != nil {
+			if firstErr == nil {
+				firstErr = result.err
+			}
 			continue
 		}
 
-		reports := []ENSReport{}
+		userReport[result.userId] = result.reports
+	}
+
+	return userReport, firstErr
+}
+
+func buildUserReport(app App, user TwitterUser) ([]ENSReport, error) {
+	reports := []ENSReport{}
+
+	locations := user.ENSDomainLocations()
 
-		for _, domain := range domains {
-			var report ENSReport
+	for _, domain := range user.ENSDomains() {
+		var report ENSReport
 
-			address, err := app.ens.CachedResolve(domain)
+		address, err := app.ens.CachedResolve(domain)
 
+		if err != nil {
+			report = ENSReport{domain: domain, valid: false}
+		} else {
+			balance, err := app.balance(address)
 			if err != nil {
-				report = ENSReport{domain, false, nil, nil}
-			} else {
-				balance := app.etherscan.CachedGetBalance(address)
-				wei, err := parseBigFloat(balance.Result)
-				check(err)
-				eth := weiToEth(wei)
-
-				report = ENSReport{domain, true, &address, eth}
+				return nil, err
 			}
 
-			reports = append(reports, report)
+			report = ENSReport{domain: domain, valid: true, address: &address, balance: balance}
+		}
+
+		report.locations = locations[domain]
+
+		if report.valid && app.config.Extract.ConfirmTextRecords && app.ens.ConfirmsTwitterHandle(domain, user.Username) {
+			report.locations = append(report.locations, DomainLocation{TextRecordSource, -1})
+		}
+
+		ownership := ClassifyOwnership(user, domain, report.locations)
+		report.ownership = &ownership
+
+		reports = append(reports, report)
+	}
+
+	if !app.config.Extract.Addresses {
+		return reports, nil
+	}
+
+	for _, address := range user.ETHAddresses() {
+		address := address
+
+		balance, err := app.balance(address)
+		if err != nil {
+			return nil, err
+		}
+
+		report := ENSReport{valid: true, address: &address, balance: balance}
+
+		if app.config.Extract.ReverseResolve {
+			name, err := app.ens.CachedReverseResolve(address)
+			if err == nil {
+				report.reverseName = name
+			} else if !errors.Is(err, errNoPrimaryName) {
+				logger.Warn("Could not look up the primary name of %s: %s", address, err)
+			}
 		}
 
-		userReport[user.Id] = reports
+		reports = append(reports, report)
+	}
+
+	return reports, nil
+}
+
+func (app App) balance(address ETHAddress) (*big.Int, error) {
+	if app.at != nil {
+		return app.ens.CachedBalanceAt(app.etherscan.cache, address, app.at.Block)
+	}
+
+	balance, err := app.etherscan.CachedGetBalance(address)
+	if err != nil {
+		return nil, fmt.Errorf("could not get the balance of %s: %w", address, err)
+	}
+
+	wei, err := parseWei(balance.Result)
+	if err != nil {
+		return nil, fmt.Errorf("etherscan returned a malformed balance for %s: %w", address, err)
 	}
 
-	return userReport
+	return wei, nil
 }
 
-func (reportMap UserENSReportMap) SortedReportList(userMap map[string]TwitterUser) []UserENSReport {
+func (reportMap UserENSReportMap) SortedReportList(userMap map[string]TwitterUser, provenance SeedProvenance) []UserENSReport {
 	reportList := []UserENSReport{}
 
 	for userId, reports := range reportMap {
 		user := userMap[userId]
-		userEnsReport := UserENSReport{user, ENSReportList{reports}}
+		userEnsReport := UserENSReport{user, ENSReportList{reports}, provenance[userId]}
 
 		reportList = append(reportList, userEnsReport)
 	}
 
 	sort.SliceStable(reportList, func(i, j int) bool {
-		return reportList[i].ensReportList.totalBalance() > reportList[j].ensReportList.totalBalance()
+		return hasMoreETH(reportList[i], reportList[j])
 	})
 
 	return reportList
 }
+
+// Accounts that hold a lot of ETH relative to their audience rank highest. Users
+// whose follower count we don't know score zero.
+func (userReport UserENSReport) ethPerFollower() float64 {
+	followers := userReport.user.FollowersCount()
+	if followers == 0 {
+		return 0
+	}
+
+	return weiToFloat(userReport.ensReportList.totalWei()) / float64(followers)
+}
+
+// Re-rank the leaderboard so accounts followed by more of the seeds float up. The
+// score is balance × seeds^weight, so a weight of 0 ranks by balance alone.
+func WeightByProximity(sortedResults []UserENSReport, weight float64) []UserENSReport {
+	if weight == 0 {
+		return sortedResults
+	}
+
+	weighted := append([]UserENSReport{}, sortedResults...)
+
+	sort.SliceStable(weighted, func(i, j int) bool {
+		return weighted[i].proximityScore(weight) > weighted[j].proximityScore(weight)
+	})
+
+	return weighted
+}
+
+func (userReport UserENSReport) proximityScore(weight float64) float64 {
+	seeds := float64(len(userReport.followedBy))
+
+	return weiToFloat(userReport.ensReportList.totalWei()) * math.Pow(seeds, weight)
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Serves stored runs over HTTP so the leaderboard can be shared without running
+// the CLI. Everything is read from the run store on each request; the optional
+// refresher is the only thing that talks to Twitter, Infura, or Etherscan.
+type Server struct {
+	config  Config
+	store   RunStore
+	refresh *Refresher
+}
+
+// Builds and stores a new run on an interval, like watch without the alerts
+type Refresher struct {
+	config   Config
+	interval time.Duration
+}
+
+func NewServer(config Config, store RunStore, refresh *Refresher) Server {
+	return Server{config, store, refresh}
+}
+
+func (server Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/api/leaderboard", server.leaderboard)
+	mux.HandleFunc("/api/users/", server.user)
+	mux.HandleFunc("/api/domains/", server.domain)
+	mux.HandleFunc("/api/runs", server.runs)
+	mux.HandleFunc("/metrics", metricsHandler)
+	mux.HandleFunc("/", server.page)
+
+	return mux
+}
+
+func (server Server) ListenAndServe(addr string) error {
+	if server.refresh != nil {
+		go server.refresh.Run(server.store)
+	}
+
+	logger.Info("Serving on %s", addr)
+
+	return http.ListenAndServe(addr, server.Handler())
+}
+
+// The user pool is loaded here rather than up front, so the server starts serving
+// stored runs straight away even if Twitter is failing
+func (refresher Refresher) Run(store RunStore) {
+	app := BootstrapAppWithRetry(refresher.config, refresher.interval)
+
+	for {
+		snapshot, err := app.Uncached().BuildSnapshot()
+		if err != nil {
+			logger.Error("Refresh failed: %s", err)
+		} else {
+			if err := store.Save(snapshot); err != nil {
+				logger.Error("Could not store run %s: %s", snapshot.Id, err)
+			} else {
+				logger.Info("Stored run %s", snapshot.Id)
+			}
+		}
+
+		time.Sleep(refresher.interval)
+	}
+}
+
+// GET /api/leaderboard?run=<id|latest>&<leaderboard flags>
+func (server Server) leaderboard(writer http.ResponseWriter, request *http.Request) {
+	config, snapshot, ok := server.loadLeaderboard(writer, request)
+	if !ok {
+		return
+	}
+
+	filtered := snapshot
+	filtered.Users = NewSnapshotUsers(leaderboardReports(config, snapshot))
+
+	writeJSON(writer, request, filtered)
+}
+
+type UserResponse struct {
+	Run  string       `json:"run"`
+	User SnapshotUser `json:"user"`
+}
+
+// GET /api/users/{handle}?run=<id|latest>
+func (server Server) user(writer http.ResponseWriter, request *http.Request) {
+	handle := strings.TrimPrefix(strings.TrimPrefix(request.URL.Path, "/api/users/"), "@")
+	if handle == "" {
+		writeError(writer, http.StatusNotFound, "no user given")
+		return
+	}
+
+	snapshot, ok := server.loadRun(writer, request)
+	if !ok {
+		return
+	}
+
+	report, found := snapshot.FindUser(handle)
+	if !found {
+		writeError(writer, http.StatusNotFound, fmt.Sprintf("@%s is not in run %s", handle, snapshot.Id))
+		return
+	}
+
+	writeJSON(writer, request, UserResponse{snapshot.Id, NewSnapshotUsers([]UserENSReport{report})[0]})
+}
+
+type DomainClaim struct {
+	Username string         `json:"username"`
+	Domain   SnapshotDomain `json:"domain"`
+}
+
+type DomainResponse struct {
+	Run    string        `json:"run"`
+	Domain ENSDomain     `json:"domain"`
+	Claims []DomainClaim `json:"claims"`
+}
+
+// GET /api/domains/{name}?run=<id|latest>. Lists every account that claims the name.
+func (server Server) domain(writer http.ResponseWriter, request *http.Request) {
+	name := ENSDomain(strings.ToLower(strings.TrimPrefix(request.URL.Path, "/api/domains/")))
+	if name == "" {
+		writeError(writer, http.StatusNotFound, "no domain given")
+		return
+	}
+
+	snapshot, ok := server.loadRun(writer, request)
+	if !ok {
+		return
+	}
+
+	claims := []DomainClaim{}
+
+	for _, user := range snapshot.Users {
+		for _, domain := range user.Domains {
+			if domain.Domain == name {
+				claims = append(claims, DomainClaim{user.User.Username, domain})
+			}
+		}
+	}
+
+	if len(claims) == 0 {
+		writeError(writer, http.StatusNotFound, fmt.Sprintf("%s is not in run %s", name, snapshot.Id))
+		return
+	}
+
+	writeJSON(writer, request, DomainResponse{snapshot.Id, name, claims})
+}
+
+// What /api/runs lists for each run, without the users
+type RunSummary struct {
+	Id          string    `json:"id"`
+	Timestamp   time.Time `json:"timestamp"`
+	ETHPrice    string    `json:"eth_price"`
+	PriceSource string    `json:"price_source,omitempty"`
+	BlockNumber uint64    `json:"block_number"`
+	Users       int       `json:"users"`
+}
+
+// GET /api/runs, oldest first
+func (server Server) runs(writer http.ResponseWriter, request *http.Request) {
+	snapshots, err := server.store.List()
+	if err != nil {
+		writeError(writer, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	summaries := []RunSummary{}
+
+	for _, snapshot := range snapshots {
+		summaries = append(summaries, RunSummary{
+			snapshot.Id, snapshot.Timestamp, snapshot.ETHPrice, snapshot.PriceSource, snapshot.BlockNumber, len(snapshot.Users),
+		})
+	}
+
+	writeJSON(writer, request, summaries)
+}
+
+type leaderboardRow struct {
+	Rank     int
+	Username string
+	Domains  string
+	ETH      string
+	Value    string
+	Seeds    int
+}
+
+type leaderboardPageData struct {
+	Run      RunSnapshot
+	Currency string
+	Price    string
+	Rows     []leaderboardRow
+}
+
+var leaderboardTemplate = template.Must(template.New("leaderboard").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>weird.flex.eth</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { padding: 0.3em 0.8em; border-bottom: 1px solid #ddd; text-align: left; }
+td.number { text-align: right; font-variant-numeric: tabular-nums; }
+</style>
+</head>
+<body>
+<h1>weird.flex.eth</h1>
+<p>Run {{.Run.Id}} at block {{.Run.BlockNumber}}. ETH/{{.Currency}} {{.Price}}.</p>
+<table>
+<tr><th>#</th><th>Twitter handle</th><th>ENS Domain</th><th>ETH Balance</th><th>{{.Currency}} Balance</th><th>Seeds</th></tr>
+{{range .Rows}}<tr><td>{{.Rank}}</td><td><a href="https://twitter.com/{{.Username}}">@{{.Username}}</a></td><td>{{.Domains}}</td><td class="number">{{.ETH}}</td><td class="number">{{.Value}}</td><td class="number">{{.Seeds}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// GET /?run=<id|latest>&<leaderboard flags>
+func (server Server) page(writer http.ResponseWriter, request *http.Request) {
+	if request.URL.Path != "/" {
+		http.NotFound(writer, request)
+		return
+	}
+
+	config, snapshot, ok := server.loadLeaderboard(writer, request)
+	if !ok {
+		return
+	}
+
+	price, err := config.Price.Currency.Convert(snapshot.Price(), config.Price.FXRates)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	currency := config.Price.Currency
+	data := leaderboardPageData{snapshot, currency.Code(), currency.Symbol() + displayMoney(price, currency), []leaderboardRow{}}
+
+	for index, report := range leaderboardReports(config, snapshot) {
+		total := report.ensReportList.totalWei()
+
+		data.Rows = append(data.Rows, leaderboardRow{
+			index + 1,
+			report.user.Username,
+			strings.Join(report.ensReportList.domains(), ", "),
+			displayETH(total, 2),
+			currency.Symbol() + displayMoney(weiValue(total, price), currency),
+			len(report.followedBy),
+		})
+	}
+
+	var body bytes.Buffer
+	check(leaderboardTemplate.Execute(&body, data))
+
+	writeWithETag(writer, request, "text/html; charset=utf-8", body.Bytes())
+}
+
+func (server Server) loadRun(writer http.ResponseWriter, request *http.Request) (RunSnapshot, bool) {
+	id := request.URL.Query().Get("run")
+	if id == "" {
+		id = "latest"
+	}
+
+	snapshot, err := loadRun(server.store, id)
+	if err != nil {
+		writeError(writer, http.StatusNotFound, err.Error())
+		return RunSnapshot{}, false
+	}
+
+	return snapshot, true
+}
+
+// The run plus the server's config with any leaderboard flags from the query
+// string applied, e.g. ?top=10&sort=followers
+func (server Server) loadLeaderboard(writer http.ResponseWriter, request *http.Request) (Config, RunSnapshot, bool) {
+	config, err := queryLeaderboardConfig(server.config, request.URL.Query())
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, err.Error())
+		return Config{}, RunSnapshot{}, false
+	}
+
+	snapshot, ok := server.loadRun(writer, request)
+
+	return config, snapshot, ok
+}
+
+// Parse the query string with the same flags as `show`, so the API accepts exactly
+// what the CLI does
+func queryLeaderboardConfig(config Config, query url.Values) (Config, error) {
+	flags := flag.NewFlagSet("query", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	leaderboardFlags := NewLeaderboardFlags(flags)
+
+	args := []string{}
+	for name, values := range query {
+		if name == "run" {
+			continue
+		}
+
+		for _, value := range values {
+			if value == "" {
+				args = append(args, "--"+name)
+			} else {
+				args = append(args, "--"+name+"="+value)
+			}
+		}
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return config, err
+	}
+
+	leaderboardFlags.Apply(&config)
+
+	if problems := config.Validate(); len(problems) > 0 {
+		return config, problems[0]
+	}
+
+	return config, nil
+}
+
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeError(writer http.ResponseWriter, status int, message string) {
+	serialized, err := json.Marshal(ErrorResponse{message})
+	check(err)
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	writer.Write(serialized)
+}
+
+func writeJSON(writer http.ResponseWriter, request *http.Request, value interface{}) {
+	serialized, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		writeError(writer, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeWithETag(writer, request, "application/json", append(serialized, '\n'))
+}
+
+// Responses only change when a new run is stored or the query changes, so clients
+// that send back the ETag get a 304 instead of the whole leaderboard again
+func writeWithETag(writer http.ResponseWriter, request *http.Request, contentType string, body []byte) {
+	hash := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(hash[:16]) + `"`
+
+	writer.Header().Set("ETag", etag)
+	writer.Header().Set("Cache-Control", "no-cache")
+
+	if etagMatches(request.Header.Get("If-None-Match"), etag) {
+		writer.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	writer.Header().Set("Content-Type", contentType)
+	writer.Write(body)
+}
+
+// If-None-Match is a comma separated list of ETags, or * for any. It uses the weak
+// comparison, so W/"abc" matches "abc".
+func etagMatches(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWriteWithETag(t *testing.T) {
+	body := []byte("{}\n")
+
+	first := httptest.NewRecorder()
+	writeWithETag(first, httptest.NewRequest(http.MethodGet, "/", nil), "application/json", body)
+	etag := first.Header().Get("ETag")
+
+	tests := []struct {
+		ifNoneMatch string
+		status      int
+	}{
+		{"", http.StatusOK},
+		{etag, http.StatusNotModified},
+		{"W/" + etag, http.StatusNotModified},
+		{`"stale", ` + etag, http.StatusNotModified},
+		{`"stale",W/` + etag, http.StatusNotModified},
+		{"*", http.StatusNotModified},
+		{`"stale"`, http.StatusOK},
+		{`W/"stale", "older"`, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.ifNoneMatch, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			if test.ifNoneMatch != "" {
+				request.Header.Set("If-None-Match", test.ifNoneMatch)
+			}
+
+			recorder := httptest.NewRecorder()
+			writeWithETag(recorder, request, "application/json", body)
+
+			if recorder.Code != test.status {
+				t.Errorf("expected %d, got %d", test.status, recorder.Code)
+			}
+
+			if recorder.Code == http.StatusOK && recorder.Body.String() != string(body) {
+				t.Errorf("expected the body, got %q", recorder.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// The same address can turn up more than once: a user listing alice.eth and
+// alice-nft.eth pointing at one wallet, or two accounts claiming the same name.
+// Within a user, totalWei counts each address once. Across users, the balance is
+// attributed according to a SharedBalanceRule.
+
+type SharedBalanceRule string
+
+const (
+	// Every claimant is credited with the full balance, so totals across the
+	// leaderboard can exceed what actually exists
+	CreditEveryone SharedBalanceRule = "everyone"
+
+	// The balance is divided evenly between claimants
+	SplitShared SharedBalanceRule = "split"
+
+	// The claimant with the strongest ownership score gets the whole balance, and
+	// ties are split
+	CreditOwner SharedBalanceRule = "owner"
+)
+
+type ConflictKind string
+
+const (
+	AddressConflict ConflictKind = "address"
+	DomainConflict  ConflictKind = "domain"
+)
+
+// An address or name claimed by more than one Twitter account
+type Conflict struct {
+	Kind      ConflictKind `json:"kind"`
+	Subject   string       `json:"subject"`
+	Usernames []string     `json:"usernames"`
+}
+
+// Addresses are compared case-insensitively since not everything is checksummed
+func addressKey(address ETHAddress) string {
+	return strings.ToLower(string(address))
+}
+
+func FindConflicts(reports []UserENSReport) []Conflict {
+	addressClaims := map[string][]string{}
+	addressLabels := map[string]ETHAddress{}
+	domainClaims := map[ENSDomain][]string{}
+
+	for _, userReport := range reports {
+		seenAddresses := map[string]bool{}
+		seenDomains := map[ENSDomain]bool{}
+
+		for _, report := range userReport.ensReportList.reports {
+			if report.domain != "" && !seenDomains[report.domain] {
+				domainClaims[report.domain] = append(domainClaims[report.domain], userReport.user.Username)
+				seenDomains[report.domain] = true
+			}
+
+			if report.valid && report.address != nil && !seenAddresses[addressKey(*report.address)] {
+				key := addressKey(*report.address)
+				addressClaims[key] = append(addressClaims[key], userReport.user.Username)
+				addressLabels[key] = *report.address
+				seenAddresses[key] = true
+			}
+		}
+	}
+
+	conflicts := []Conflict{}
+
+	for domain, usernames := range domainClaims {
+		if len(usernames) > 1 {
+			conflicts = append(conflicts, Conflict{DomainConflict, string(domain), usernames})
+		}
+	}
+
+	for key, usernames := range addressClaims {
+		if len(usernames) > 1 {
+			conflicts = append(conflicts, Conflict{AddressConflict, string(addressLabels[key]), usernames})
+		}
+	}
+
+	sort.SliceStable(conflicts, func(i, j int) bool {
+		if len(conflicts[i].Usernames) != len(conflicts[j].Usernames) {
+			return len(conflicts[i].Usernames) > len(conflicts[j].Usernames)
+		}
+
+		if conflicts[i].Kind != conflicts[j].Kind {
+			return conflicts[i].Kind < conflicts[j].Kind
+		}
+
+		return conflicts[i].Subject < conflicts[j].Subject
+	})
+
+	for _, conflict := range conflicts {
+		sort.Strings(conflict.Usernames)
+	}
+
+	return conflicts
+}
+
+// One user's claim on an address, with their strongest ownership score for it
+type addressClaim struct {
+	user      int // Index into the leaderboard
+	ownership float64
+}
+
+// Re-credit balances of addresses claimed by several users according to the rule,
+// re-sorting the leaderboard by the result. Each entry for a shared address notes
+// who else claimed it.
+func AttributeSharedBalances(sortedResults []UserENSReport, rule SharedBalanceRule) []UserENSReport {
+	claims := map[string][]addressClaim{}
+
+	for index, userReport := range sortedResults {
+		best := map[string]float64{}
+
+		for _, report := range userReport.ensReportList.reports {
+			if !report.valid || report.address == nil {
+				continue
+			}
+
+			key := addressKey(*report.address)
+			score := ownershipScore(report)
+
+			if previous, isPresent := best[key]; !isPresent || score > previous {
+				best[key] = score
+			}
+		}
+
+		for key, score := range best {
+			claims[key] = append(claims[key], addressClaim{index, score})
+		}
+	}
+
+	// How many wei of each shared address every claimant is credited with
+	credits := map[string]map[int]*big.Int{}
+
+	for key, addressClaims := range claims {
+		if len(addressClaims) > 1 {
+			balance := sharedBalance(sortedResults[addressClaims[0].user], key)
+			credits[key] = creditClaimants(addressClaims, balance, rule)
+		}
+	}
+
+	if len(credits) == 0 {
+		return sortedResults
+	}
+
+	attributed := []UserENSReport{}
+
+	for index, userReport := range sortedResults {
+		reports := []ENSReport{}
+		creditedAddresses := map[string]bool{}
+
+		for _, report := range userReport.ensReportList.reports {
+			if report.valid && report.address != nil {
+				key := addressKey(*report.address)
+
+				if userCredits, isShared := credits[key]; isShared {
+					report.sharedWith = otherClaimants(sortedResults, claims[key], index)
+
+					// Only the first entry for the address carries the credit so it is
+					// counted once however many names point at it
+					report.balance = new(big.Int)
+					if !creditedAddresses[key] {
+						report.balance = userCredits[index]
+						creditedAddresses[key] = true
+					}
+				}
+			}
+
+			reports = append(reports, report)
+		}
+
+		userReport.ensReportList = ENSReportList{reports}
+		attributed = append(attributed, userReport)
+	}
+
+	sort.SliceStable(attributed, func(i, j int) bool {
+		return hasMoreETH(attributed[i], attributed[j])
+	})
+
+	return attributed
+}
+
+func creditClaimants(claims []addressClaim, balance *big.Int, rule SharedBalanceRule) map[int]*big.Int {
+	credits := map[int]*big.Int{}
+	credited := []int{}
+
+	top := claims[0].ownership
+	for _, claim := range claims {
+		credits[claim.user] = new(big.Int)
+
+		if claim.ownership > top {
+			top = claim.ownership
+		}
+	}
+
+	for _, claim := range claims {
+		if rule != CreditOwner || claim.ownership == top {
+			credited = append(credited, claim.user)
+		}
+	}
+
+	if rule == CreditEveryone {
+		for _, user := range credited {
+			credits[user] = new(big.Int).Set(balance)
+		}
+
+		return credits
+	}
+
+	// Whatever doesn't divide evenly goes to the highest ranked claimant so the
+	// shares still add up to the balance
+	share, remainder := new(big.Int).QuoRem(balance, big.NewInt(int64(len(credited))), new(big.Int))
+	sort.Ints(credited)
+
+	for position, user := range credited {
+		credits[user] = new(big.Int).Set(share)
+
+		if position == 0 {
+			credits[user].Add(credits[user], remainder)
+		}
+	}
+
+	return credits
+}
+
+func ownershipScore(report ENSReport) float64 {
+	if report.ownership == nil {
+		// Addresses posted directly, or runs from before classification
+		return 1
+	}
+
+	return report.ownership.Score
+}
+
+func sharedBalance(userReport UserENSReport, key string) *big.Int {
+	for _, report := range userReport.ensReportList.reports {
+		if report.valid && report.address != nil && report.balance != nil && addressKey(*report.address) == key {
+			return report.balance
+		}
+	}
+
+	return new(big.Int)
+}
+
+func otherClaimants(reports []UserENSReport, claims []addressClaim, self int) []string {
+	usernames := []string{}
+
+	for _, claim := range claims {
+		if claim.user != self {
+			usernames = append(usernames, reports[claim.user].user.Username)
+		}
+	}
+
+	sort.Strings(usernames)
+
+	return usernames
+}
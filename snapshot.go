@@ -0,0 +1,338 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// A RunSnapshot is everything we need to reprint a leaderboard later without going
+// back to Twitter, Infura, or Etherscan.
+type RunSnapshot struct {
+	Id             string         `json:"id"`
+	Timestamp      time.Time      `json:"timestamp"`
+	ETHPrice       string         `json:"eth_price"` // In USD
+	PriceSource    string         `json:"price_source,omitempty"`
+	PriceTimestamp *time.Time     `json:"price_timestamp,omitempty"` // When the oracle last updated the price
+	BlockNumber    uint64         `json:"block_number"`
+	PointInTime    bool           `json:"point_in_time,omitempty"` // Balances are as of BlockNumber rather than when the run happened
+	Users          []SnapshotUser `json:"users"`
+	SeedFollows    map[string]int `json:"seed_follows,omitempty"` // Accounts each seed user contributed to the pool
+}
+
+type SnapshotUser struct {
+	User       TwitterUser      `json:"user"`
+	Domains    []SnapshotDomain `json:"domains"`
+	FollowedBy []string         `json:"followed_by,omitempty"` // Seed usernames
+}
+
+type SnapshotDomain struct {
+	Domain      ENSDomain        `json:"domain"` // Empty for addresses posted directly
+	Valid       bool             `json:"valid"`
+	Address     *ETHAddress      `json:"address,omitempty"`
+	Balance     *string          `json:"balance,omitempty"` // Exact amount in ETH, for people reading the JSON
+	BalanceWei  *string          `json:"balance_wei,omitempty"`
+	ReverseName ENSDomain        `json:"reverse_name,omitempty"`
+	Locations   []DomainLocation `json:"locations,omitempty"`
+	Ownership   *Ownership       `json:"ownership,omitempty"`
+	SharedWith  []string         `json:"shared_with,omitempty"`
+}
+
+// Microseconds keep runs started in the same second (a short watch interval, or
+// serve refreshing alongside a CLI run) apart. The fixed width keeps ids sorting
+// chronologically.
+const RunIdFormat = "20060102T150405.000000Z"
+
+func NewRunSnapshot(timestamp time.Time, quote PriceQuote, blockNumber uint64, reports []UserENSReport) RunSnapshot {
+	timestamp = timestamp.UTC()
+
+	return RunSnapshot{
+		Id:             timestamp.Format(RunIdFormat),
+		Timestamp:      timestamp,
+		ETHPrice:       formatDecimal(quote.Price),
+		PriceSource:    quote.Source,
+		PriceTimestamp: &quote.Timestamp,
+		BlockNumber:    blockNumber,
+		Users:          NewSnapshotUsers(reports),
+	}
+}
+
+func NewSnapshotUsers(reports []UserENSReport) []SnapshotUser {
+	users := []SnapshotUser{}
+
+	for _, userReport := range reports {
+		domains := []SnapshotDomain{}
+
+		for _, report := range userReport.ensReportList.reports {
+			domain := SnapshotDomain{report.domain, report.valid, report.address, nil, nil, report.reverseName, report.locations, report.ownership, report.sharedWith}
+
+			if report.balance != nil {
+				balance := FormatETH(report.balance)
+				balanceWei := report.balance.String()
+				domain.Balance = &balance
+				domain.BalanceWei = &balanceWei
+			}
+
+			domains = append(domains, domain)
+		}
+
+		users = append(users, SnapshotUser{userReport.user, domains, userReport.followedBy})
+	}
+
+	return users
+}
+
+func (snapshot RunSnapshot) Price() *big.Rat {
+	price, err := parseDecimal(snapshot.ETHPrice)
+	check(err)
+
+	return price
+}
+
+// Rebuild the in-memory report types so stored runs can reuse the same rendering
+// code as live runs.
+func (snapshot RunSnapshot) Reports() []UserENSReport {
+	reports := []UserENSReport{}
+
+	for _, user := range snapshot.Users {
+		ensReports := []ENSReport{}
+
+		for _, domain := range user.Domains {
+			report := ENSReport{domain.Domain, domain.Valid, domain.Address, nil, domain.ReverseName, domain.Locations, domain.Ownership, domain.SharedWith}
+
+			if domain.BalanceWei != nil {
+				balance, err := parseWei(*domain.BalanceWei)
+				check(err)
+				report.balance = balance
+			} else if domain.Balance != nil {
+				// Runs stored before balances were kept in wei only have the ETH amount
+				balance, err := parseDecimal(*domain.Balance)
+				check(err)
+				report.balance = ethToWei(balance)
+			}
+
+			ensReports = append(ensReports, report)
+		}
+
+		reports = append(reports, UserENSReport{user.User, ENSReportList{ensReports}, user.FollowedBy})
+	}
+
+	return reports
+}
+
+func (snapshot RunSnapshot) FindUser(username string) (UserENSReport, bool) {
+	for _, report := range snapshot.Reports() {
+		if strings.EqualFold(report.user.Username, username) {
+			return report, true
+		}
+	}
+
+	return UserENSReport{}, false
+}
+
+// Persistence for snapshots. Runs live in their own bbolt file (separate from the
+// API cache) so clearing the cache never throws away history. The file is opened
+// for each operation rather than held, so serve and watch don't lock out the other
+// commands; reads take a shared lock and only Save needs an exclusive one.
+
+type RunStore struct {
+	path string
+}
+
+var runsBucket = []byte("runs")
+
+var errNoRuns = errors.New("no runs have been stored yet")
+
+func NewRunStore(dbPath string) RunStore {
+	return RunStore{dbPath}
+}
+
+// Refuses to overwrite an existing run rather than silently replacing it
+func (store RunStore) Save(snapshot RunSnapshot) error {
+	serialized, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	dbPath, err := JoinProjectPath(store.path)
+	if err != nil {
+		return err
+	}
+
+	if err := EnsureDirExists(filepath.Dir(dbPath)); err != nil {
+		return err
+	}
+
+	db, err := openBolt(dbPath, false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(runsBucket)
+		if err != nil {
+			return err
+		}
+
+		if bucket.Get([]byte(snapshot.Id)) != nil {
+			return fmt.Errorf("a run with id %s is already stored", snapshot.Id)
+		}
+
+		return bucket.Put([]byte(snapshot.Id), serialized)
+	})
+}
+
+// Run read against the runs bucket, or return errNoRuns if nothing has been saved
+func (store RunStore) view(read func(bucket *bolt.Bucket) error) error {
+	dbPath, err := JoinProjectPath(store.path)
+	if err != nil {
+		return err
+	}
+
+	pathType, err := checkPathType(dbPath)
+	if err != nil {
+		return err
+	}
+
+	if pathType == DoesNotExist {
+		return errNoRuns
+	}
+
+	db, err := openBolt(dbPath, true)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(runsBucket)
+		if bucket == nil {
+			return errNoRuns
+		}
+
+		return read(bucket)
+	})
+}
+
+func (store RunStore) Get(id string) (RunSnapshot, error) {
+	var snapshot RunSnapshot
+
+	err := store.view(func(bucket *bolt.Bucket) error {
+		value := bucket.Get([]byte(id))
+
+		if value == nil {
+			return fmt.Errorf("no run found with id %s", id)
+		}
+
+		return json.Unmarshal(value, &snapshot)
+	})
+
+	return snapshot, err
+}
+
+// Every stored run, oldest first. Run ids are timestamps so bbolt's byte ordering
+// is also chronological ordering.
+func (store RunStore) List() ([]RunSnapshot, error) {
+	snapshots := []RunSnapshot{}
+
+	err := store.view(func(bucket *bolt.Bucket) error {
+		return bucket.ForEach(func(key []byte, value []byte) error {
+			var snapshot RunSnapshot
+			if err := json.Unmarshal(value, &snapshot); err != nil {
+				return err
+			}
+
+			snapshots = append(snapshots, snapshot)
+			return nil
+		})
+	})
+
+	if errors.Is(err, errNoRuns) {
+		return snapshots, nil
+	}
+
+	return snapshots, err
+}
+
+func (store RunStore) Latest() (RunSnapshot, error) {
+	var snapshot RunSnapshot
+
+	err := store.view(func(bucket *bolt.Bucket) error {
+		key, value := bucket.Cursor().Last()
+
+		if key == nil {
+			return errNoRuns
+		}
+
+		return json.Unmarshal(value, &snapshot)
+	})
+
+	return snapshot, err
+}
+
+// Run the price, resolve, and balance stages against the app's user pool
+func (app App) BuildSnapshot() (RunSnapshot, error) {
+	if app.at != nil {
+		return app.buildHistoricalSnapshot()
+	}
+
+	quote, err := app.prices.ETHUSDPrice()
+	if err != nil {
+		return RunSnapshot{}, fmt.Errorf("could not get the ETH price from %s: %w", app.config.Price.Oracle, err)
+	}
+
+	logger.Debug("ETH/USD price: %s from %s\n\n", formatDecimal(quote.Price), quote.Source)
+
+	userReport, err := BuildReport(app, app.users)
+	if err != nil {
+		return RunSnapshot{}, err
+	}
+
+	sortedResults := userReport.SortedReportList(app.users, app.provenance)
+
+	blockNumber, err := app.ens.BlockNumber()
+	if err != nil {
+		return RunSnapshot{}, fmt.Errorf("could not get the block number: %w", err)
+	}
+
+	snapshot := NewRunSnapshot(time.Now(), quote, blockNumber, sortedResults)
+	snapshot.SeedFollows = app.provenance.FollowCounts()
+
+	return snapshot, nil
+}
+
+// Like BuildSnapshot, but with balances at the app's past block valued at the ETH
+// price of that day
+func (app App) buildHistoricalSnapshot() (RunSnapshot, error) {
+	history, source, err := NewHistoricalPriceOracle(app.config.Price, app.etherscan, app.ens)
+	if err != nil {
+		return RunSnapshot{}, err
+	}
+
+	quote, err := CachedHistoricalPrice(app.etherscan.cache, history, source, *app.at)
+	if err != nil {
+		return RunSnapshot{}, fmt.Errorf("could not get the ETH price for %s from %s: %w", app.at.Date.Format(DateFormat), source, err)
+	}
+
+	logger.Debug("ETH/USD price on %s: %s from %s\n\n", app.at.Date.Format(DateFormat), formatDecimal(quote.Price), quote.Source)
+
+	userReport, err := BuildReport(app, app.users)
+	if err != nil {
+		return RunSnapshot{}, err
+	}
+
+	sortedResults := userReport.SortedReportList(app.users, app.provenance)
+
+	snapshot := NewRunSnapshot(time.Now(), quote, app.at.Block, sortedResults)
+	snapshot.SeedFollows = app.provenance.FollowCounts()
+	snapshot.PointInTime = true
+
+	return snapshot, nil
+}
@@ -3,9 +3,9 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"log"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/gosimple/slug"
 )
@@ -27,7 +27,7 @@ func NewTwitterClient(bearerToken string) TwitterClient {
 	return client
 }
 
-// API Response type for /2/users/by/:username
+// API Response type for /2/users/by/:username and /2/users?ids=
 type TwitterAPIUsersList struct {
 	Data []struct {
 		Id       string
@@ -36,17 +36,17 @@ type TwitterAPIUsersList struct {
 	}
 }
 
-type TwitterAPIListFollowingRequestOptions struct {
+type TwitterAPIListUsersRequestOptions struct {
 	PaginationToken *string
 }
 
 // This type is used to create a Cacheable request
-type TwitterAPIListFollowingRequestInput struct {
+type TwitterAPIListUsersRequestInput struct {
 	path   string
 	params map[string]string
 }
 
-func (req TwitterAPIListFollowingRequestInput) CacheKey() string {
+func (req TwitterAPIListUsersRequestInput) CacheKey() string {
 	token, isPresent := req.params["pagination_token"]
 	var tokenDisplay string
 
@@ -79,11 +79,119 @@ var UserFields = []string{
 // This is a struct a single user in the list we get back from /2/users/:id/following
 // More importantly though, this is also the Twitter user struct we pass around for analysis
 type TwitterUser struct {
-	Id          string  `json:"id"`
-	Name        string  `json:"name"`
-	Url         *string `json:"url"`
-	Username    string  `json:"username"`
-	Description string  `json:"description"`
+	Id          string               `json:"id"`
+	Name        string               `json:"name"`
+	Url         *string              `json:"url"`
+	Username    string               `json:"username"`
+	Description string               `json:"description"`
+	Entities    *TwitterUserEntities `json:"entities,omitempty"`
+
+	PublicMetrics   *TwitterPublicMetrics `json:"public_metrics,omitempty"`
+	Verified        bool                  `json:"verified,omitempty"`
+	CreatedAt       *time.Time            `json:"created_at,omitempty"`
+	Location        string                `json:"location,omitempty"`
+	ProfileImageUrl string                `json:"profile_image_url,omitempty"`
+	Protected       bool                  `json:"protected,omitempty"`
+	Withheld        *TwitterWithheld      `json:"withheld,omitempty"`
+
+	PinnedTweetId string        `json:"pinned_tweet_id,omitempty"`
+	PinnedTweet   *TwitterTweet `json:"pinned_tweet,omitempty"` // Only set when pinned tweets are fetched
+}
+
+type TwitterPublicMetrics struct {
+	FollowersCount int `json:"followers_count"`
+	FollowingCount int `json:"following_count"`
+	TweetCount     int `json:"tweet_count"`
+	ListedCount    int `json:"listed_count"`
+}
+
+// Set when an account is withheld in some countries
+type TwitterWithheld struct {
+	CountryCodes []string `json:"country_codes"`
+	Scope        string   `json:"scope,omitempty"`
+}
+
+// Zero when we don't know, e.g. for profiles imported without public metrics
+func (user TwitterUser) FollowersCount() int {
+	if user.PublicMetrics == nil {
+		return 0
+	}
+
+	return user.PublicMetrics.FollowersCount
+}
+
+// How long ago the account was created, or zero if we don't know
+func (user TwitterUser) AccountAge(now time.Time) time.Duration {
+	if user.CreatedAt == nil {
+		return 0
+	}
+
+	return now.Sub(*user.CreatedAt)
+}
+
+type TwitterTweet struct {
+	Id       string `json:"id"`
+	Text     string `json:"text"`
+	Entities *struct {
+		Urls []TwitterURLEntity `json:"urls"`
+	} `json:"entities,omitempty"`
+}
+
+func (tweet TwitterTweet) ExpandedUrls() []string {
+	urls := []string{}
+
+	if tweet.Entities == nil {
+		return urls
+	}
+
+	for _, entity := range tweet.Entities.Urls {
+		if entity.ExpandedUrl != "" {
+			urls = append(urls, entity.ExpandedUrl)
+		}
+	}
+
+	return urls
+}
+
+// Twitter shortens every link in a profile to t.co, but tells us where each one
+// actually goes in the entities field
+type TwitterUserEntities struct {
+	Url struct {
+		Urls []TwitterURLEntity `json:"urls"`
+	} `json:"url"`
+	Description struct {
+		Urls []TwitterURLEntity `json:"urls"`
+	} `json:"description"`
+}
+
+type TwitterURLEntity struct {
+	Start       int    `json:"start"`
+	End         int    `json:"end"`
+	Url         string `json:"url"`
+	ExpandedUrl string `json:"expanded_url"`
+	DisplayUrl  string `json:"display_url"`
+}
+
+// Where the profile URL and any links in the bio really point
+func (user TwitterUser) ExpandedUrls() []string {
+	urls := []string{}
+
+	// Profiles from an offline import may already have the real URL
+	if user.Url != nil && *user.Url != "" && !strings.Contains(*user.Url, "t.co/") {
+		urls = append(urls, *user.Url)
+	}
+
+	if user.Entities == nil {
+		return urls
+	}
+
+	for _, entity := range append(user.Entities.Url.Urls, user.Entities.Description.Urls...) {
+		if entity.ExpandedUrl != "" {
+			urls = append(urls, entity.ExpandedUrl)
+		}
+	}
+
+	return urls
 }
 
 const MaxDescriptionLength = 50
@@ -100,7 +208,7 @@ func (user TwitterUser) ShortDescription() string {
 	return desc
 }
 
-// Struct for the API Response for a single page from /2/users/:id/following
+// Struct for the API Response for a single page from any TwitterUserListEndpoint
 type PaginatedUserList struct {
 	Data []TwitterUser
 	Meta struct {
@@ -109,67 +217,263 @@ type PaginatedUserList struct {
 	}
 }
 
-// Given a UserID, get a single page of 1000 users they are following via /2/users/:id/following
-func (tw TwitterClient) CachedListFollowing(userId string, cache FileSystemCache, options TwitterAPIListFollowingRequestOptions) PaginatedUserList {
+// A paginated endpoint which returns a list of users
+type TwitterUserListEndpoint struct {
+	path       string
+	maxResults int
+}
+
+func FollowingEndpoint(userId string) TwitterUserListEndpoint {
+	return TwitterUserListEndpoint{fmt.Sprintf("/2/users/%s/following", userId), 1000}
+}
+
+func FollowersEndpoint(userId string) TwitterUserListEndpoint {
+	return TwitterUserListEndpoint{fmt.Sprintf("/2/users/%s/followers", userId), 1000}
+}
+
+func ListMembersEndpoint(listId string) TwitterUserListEndpoint {
+	return TwitterUserListEndpoint{fmt.Sprintf("/2/lists/%s/members", listId), 100}
+}
+
+func (endpoint TwitterUserListEndpoint) requestInput(options TwitterAPIListUsersRequestOptions) TwitterAPIListUsersRequestInput {
 	// TODO: This method could be slimmed down a lot if I change up how I compute the cache key
-	path := fmt.Sprintf("/2/users/%s/following", userId)
 	params := make(map[string]string)
 
 	if options.PaginationToken != nil {
 		params["pagination_token"] = *options.PaginationToken
 	}
 
-	requestInput := TwitterAPIListFollowingRequestInput{path, params}
-	paginatedUserList, err := WithJSONCache(cache, requestInput, func() (PaginatedUserList, error) {
-		return tw.ListFollowing(userId, cache, options), nil
+	return TwitterAPIListUsersRequestInput{endpoint.path, params}
+}
+
+// Get a single page of users from the endpoint, e.g. 1000 users someone is following
+func (tw TwitterClient) CachedListUsers(endpoint TwitterUserListEndpoint, cache Cache, options TwitterAPIListUsersRequestOptions) (PaginatedUserList, error) {
+	return WithJSONCache(cache, endpoint.requestInput(options), func() (PaginatedUserList, error) {
+		return tw.ListUsers(endpoint, options)
 	})
-	check(err)
+}
 
-	return paginatedUserList
+// Whether the first page of an endpoint is already cached, meaning ListAllUsers can
+// start without spending any of the Twitter rate limit.
+func (tw TwitterClient) IsUserListCached(endpoint TwitterUserListEndpoint, cache Cache) bool {
+	return cache.IsCached(endpoint.requestInput(TwitterAPIListUsersRequestOptions{}))
 }
 
-func (tw TwitterClient) ListFollowing(userId string, cache FileSystemCache, options TwitterAPIListFollowingRequestOptions) PaginatedUserList {
-	path := fmt.Sprintf("/2/users/%s/following", userId)
+func (tw TwitterClient) ListUsers(endpoint TwitterUserListEndpoint, options TwitterAPIListUsersRequestOptions) (PaginatedUserList, error) {
 	params := make(map[string]string)
-	params["max_results"] = "1000"
+	params["max_results"] = fmt.Sprintf("%d", endpoint.maxResults)
 	params["user.fields"] = strings.Join(UserFields, ",")
 
 	if options.PaginationToken != nil {
 		params["pagination_token"] = *options.PaginationToken
 	}
 
-	url := apiRoute(path, params)
+	url := apiRoute(endpoint.path, params)
 	var paginatedUserList PaginatedUserList
 	var rawResponse []byte
 
-	logger.Debug("Performing live request for users %s is following\n", userId)
+	logger.Debug("Performing live request for %s\n", endpoint.path)
 
 	rawResponse, err := tw.get(url)
 	if err != nil {
-		log.Fatal(err)
+		return paginatedUserList, err
 	}
 
 	json.Unmarshal(rawResponse, &paginatedUserList)
 
-	return paginatedUserList
+	return paginatedUserList, nil
 }
 
 // Expand a list of usernames into user IDs.
 func (tw TwitterClient) LookupUsers(usernames []string) (TwitterAPIUsersList, error) {
-	serializedQuery := strings.Join(usernames, ",")
-	uri := apiRoute("/2/users/by", map[string]string{"usernames": serializedQuery})
+	return tw.lookupUsersInBatches("/2/users/by", "usernames", usernames)
+}
 
-	responseBody, err := tw.get(uri)
-	if err != nil {
-		return TwitterAPIUsersList{}, err
-	}
+// Look up users by id. Used to find the current username of a renamed account.
+func (tw TwitterClient) LookupUserIds(ids []string) (TwitterAPIUsersList, error) {
+	return tw.lookupUsersInBatches("/2/users", "ids", ids)
+}
 
+// Both lookups take at most 100 usernames or ids per request
+func (tw TwitterClient) lookupUsersInBatches(path string, param string, values []string) (TwitterAPIUsersList, error) {
 	var userList TwitterAPIUsersList
-	json.Unmarshal(responseBody, &userList)
+
+	for start := 0; start < len(values); start += MaxUsernamesPerLookup {
+		end := start + MaxUsernamesPerLookup
+		if end > len(values) {
+			end = len(values)
+		}
+
+		uri := apiRoute(path, map[string]string{param: strings.Join(values[start:end], ",")})
+
+		responseBody, err := tw.get(uri)
+		if err != nil {
+			return userList, err
+		}
+
+		var batch TwitterAPIUsersList
+		json.Unmarshal(responseBody, &batch)
+
+		userList.Data = append(userList.Data, batch.Data...)
+	}
 
 	return userList, nil
 }
 
+// Cacheable subject for a single profile looked up by username
+type TwitterUsernameLookup string
+
+func (username TwitterUsernameLookup) CacheKey() string {
+	return slug.Make("/2/users/by/username/" + strings.ToLower(string(username)))
+}
+
+// Twitter allows up to 100 usernames (or ids) per /2/users/by (or /2/users) request
+const MaxUsernamesPerLookup = 100
+
+// Look up full profiles for an explicit list of usernames. Each profile is cached
+// on its own so adding one username doesn't refetch the rest.
+func (tw TwitterClient) CachedLookupProfiles(usernames []string, cache Cache) ([]TwitterUser, error) {
+	users := []TwitterUser{}
+	uncached := []string{}
+
+	for _, username := range usernames {
+		subject := TwitterUsernameLookup(username)
+
+		if !cache.IsCached(subject) {
+			uncached = append(uncached, username)
+			continue
+		}
+
+		var user TwitterUser
+		json.Unmarshal(cache.ReadCache(subject), &user)
+		users = append(users, user)
+	}
+
+	for start := 0; start < len(uncached); start += MaxUsernamesPerLookup {
+		end := start + MaxUsernamesPerLookup
+		if end > len(uncached) {
+			end = len(uncached)
+		}
+
+		uri := apiRoute("/2/users/by", map[string]string{
+			"usernames":   strings.Join(uncached[start:end], ","),
+			"user.fields": strings.Join(UserFields, ","),
+		})
+
+		logger.Debug("Performing live profile lookup for %d users\n", end-start)
+
+		responseBody, err := tw.get(uri)
+		if err != nil {
+			return users, err
+		}
+
+		var response struct {
+			Data []TwitterUser
+		}
+		json.Unmarshal(responseBody, &response)
+
+		for _, user := range response.Data {
+			serialized, err := json.Marshal(user)
+			if err != nil {
+				return users, err
+			}
+
+			cache.WriteCache(TwitterUsernameLookup(user.Username), serialized)
+			users = append(users, user)
+		}
+
+		if len(response.Data) < end-start {
+			logger.Warn("Twitter only returned %d of %d requested profiles", len(response.Data), end-start)
+		}
+	}
+
+	return users, nil
+}
+
+// Cacheable subject for a pinned tweet. Tweets that have since been deleted are
+// cached with only their id so we don't keep asking for them.
+type TwitterTweetLookup string
+
+func (tweetId TwitterTweetLookup) CacheKey() string {
+	return slug.Make("/2/tweets/" + string(tweetId))
+}
+
+// Fetch the pinned tweet of every user who has one, keyed by tweet id. The tweets
+// come back as an expansion of a /2/users lookup, so 100 users cost one request.
+func (tw TwitterClient) CachedPinnedTweets(users []TwitterUser, cache Cache) (map[string]TwitterTweet, error) {
+	tweets := map[string]TwitterTweet{}
+	uncached := []TwitterUser{}
+
+	for _, user := range users {
+		if user.PinnedTweetId == "" {
+			continue
+		}
+
+		subject := TwitterTweetLookup(user.PinnedTweetId)
+
+		if !cache.IsCached(subject) {
+			uncached = append(uncached, user)
+			continue
+		}
+
+		var tweet TwitterTweet
+		json.Unmarshal(cache.ReadCache(subject), &tweet)
+		tweets[tweet.Id] = tweet
+	}
+
+	for start := 0; start < len(uncached); start += MaxUsernamesPerLookup {
+		end := start + MaxUsernamesPerLookup
+		if end > len(uncached) {
+			end = len(uncached)
+		}
+
+		ids := []string{}
+		for _, user := range uncached[start:end] {
+			ids = append(ids, user.Id)
+		}
+
+		uri := apiRoute("/2/users", map[string]string{
+			"ids":          strings.Join(ids, ","),
+			"expansions":   "pinned_tweet_id",
+			"tweet.fields": "entities",
+		})
+
+		logger.Debug("Performing live pinned tweet lookup for %d users\n", end-start)
+
+		responseBody, err := tw.get(uri)
+		if err != nil {
+			return tweets, err
+		}
+
+		var response struct {
+			Includes struct {
+				Tweets []TwitterTweet
+			}
+		}
+		json.Unmarshal(responseBody, &response)
+
+		for _, tweet := range response.Includes.Tweets {
+			tweets[tweet.Id] = tweet
+		}
+
+		for _, user := range uncached[start:end] {
+			tweet, isPresent := tweets[user.PinnedTweetId]
+			if !isPresent {
+				tweet = TwitterTweet{Id: user.PinnedTweetId}
+			}
+
+			serialized, err := json.Marshal(tweet)
+			if err != nil {
+				return tweets, err
+			}
+
+			cache.WriteCache(TwitterTweetLookup(user.PinnedTweetId), serialized)
+		}
+	}
+
+	return tweets, nil
+}
+
 func apiRoute(path string, query map[string]string) string {
 	baseUrl, err := url.Parse(Hostname)
 	check(err)
@@ -192,22 +496,30 @@ func (tw TwitterClient) get(url string) ([]byte, error) {
 	})
 }
 
-// Facade that reads each page from `ListFollowing`.
+// Facade that reads each page from `ListUsers`.
 // NOTE: This doesn't play well with Twitter rate limits. If you hit a rate limit, just run the program again.
-func (tw TwitterClient) ListAllFollowing(userId string, cache FileSystemCache) []TwitterUser {
-	var following []TwitterUser
+func (tw TwitterClient) ListAllUsers(endpoint TwitterUserListEndpoint, cache Cache) ([]TwitterUser, error) {
+	var users []TwitterUser
 
-	options := TwitterAPIListFollowingRequestOptions{}
+	options := TwitterAPIListUsersRequestOptions{}
 
 	for {
-		followingPage := tw.CachedListFollowing(userId, cache, options)
-		following = append(following, followingPage.Data...)
-		options.PaginationToken = followingPage.Meta.NextToken
+		page, err := tw.CachedListUsers(endpoint, cache, options)
+		if err != nil {
+			return users, err
+		}
+
+		users = append(users, page.Data...)
+		options.PaginationToken = page.Meta.NextToken
 
 		if options.PaginationToken == nil {
 			break
 		}
 	}
 
-	return following
+	return users, nil
+}
+
+func (tw TwitterClient) ListAllFollowing(userId string, cache Cache) ([]TwitterUser, error) {
+	return tw.ListAllUsers(FollowingEndpoint(userId), cache)
 }
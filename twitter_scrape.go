@@ -4,33 +4,68 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"strings"
+)
+
+type SeedSource string
+
+const (
+	FollowingSource SeedSource = "following"
+	FollowersSource SeedSource = "followers"
 )
 
 type TwitterScrapeSeedUser struct {
-	Username string  `json:"username"`
-	Id       *string `json:"id,omitempty"`
-	Enabled  bool    `json:"enabled"`
+	Username string       `json:"username"`
+	Id       *string      `json:"id,omitempty"`
+	Enabled  bool         `json:"enabled"`
+	Sources  []SeedSource `json:"sources,omitempty"` // Defaults to following
+}
+
+func (user TwitterScrapeSeedUser) sources() []SeedSource {
+	if len(user.Sources) == 0 {
+		return []SeedSource{FollowingSource}
+	}
+
+	return user.Sources
 }
 
-func (user TwitterScrapeSeedUser) String() string {
-	var idDisplay string
-	if user.Id != nil {
-		idDisplay = *user.Id
-	} else {
-		idDisplay = "Nil"
+// e.g. "@alice (following, followers)"
+func (user TwitterScrapeSeedUser) label() string {
+	sources := []string{}
+	for _, source := range user.sources() {
+		sources = append(sources, string(source))
 	}
 
-	return fmt.Sprintf("TwitterScrapeSeedUser(username=%s, id=%s)", user.Username, idDisplay)
+	return fmt.Sprintf("@%s (%s)", user.Username, strings.Join(sources, ", "))
+}
+
+// A Twitter List whose members are added to the pool
+type TwitterScrapeSeedList struct {
+	Id      string `json:"id"`
+	Name    string `json:"name,omitempty"` // Only used for display
+	Enabled bool   `json:"enabled"`
+}
+
+func (list TwitterScrapeSeedList) label() string {
+	if list.Name != "" {
+		return "list:" + list.Name
+	}
+
+	return "list:" + list.Id
 }
 
 type TwitterScrapeSeedInstructions struct {
-	Users []TwitterScrapeSeedUser `json:"users"`
+	Users     []TwitterScrapeSeedUser `json:"users"`
+	Lists     []TwitterScrapeSeedList `json:"lists,omitempty"`
+	Usernames []string                `json:"usernames,omitempty"` // Accounts added to the pool directly
 }
 
-const SeedFile = "config/seed.json"
+// Provenance label for accounts that were added by username rather than found
+// through a seed user or list
+const ExplicitUsernamesLabel = "usernames"
 
-func LoadTwitterScrapeSeed() (TwitterScrapeSeedInstructions, error) {
-	seedFileContents, err := ioutil.ReadFile(SeedFile)
+func LoadTwitterScrapeSeed(path string) (TwitterScrapeSeedInstructions, error) {
+	seedFileContents, err := ioutil.ReadFile(path)
 	if err != nil {
 		return TwitterScrapeSeedInstructions{}, err
 	}
@@ -41,10 +76,20 @@ func LoadTwitterScrapeSeed() (TwitterScrapeSeedInstructions, error) {
 		return TwitterScrapeSeedInstructions{}, err
 	}
 
+	for _, user := range seed.Users {
+		for _, source := range user.Sources {
+			if source != FollowingSource && source != FollowersSource {
+				return TwitterScrapeSeedInstructions{}, fmt.Errorf("seed user %s has unknown source %q (expected following or followers)", user.Username, source)
+			}
+		}
+	}
+
 	return seed, nil
 }
 
-func (seed TwitterScrapeSeedInstructions) Inflate(client TwitterClient) TwitterScrapeSeedInstructions {
+// Fill in ids for seed users that don't have one yet. The second return value
+// reports whether anything changed, so callers only rewrite the seed file when needed.
+func (seed TwitterScrapeSeedInstructions) Inflate(client TwitterClient) (TwitterScrapeSeedInstructions, bool) {
 	var usernames []string
 
 	for _, user := range seed.Users {
@@ -55,7 +100,7 @@ func (seed TwitterScrapeSeedInstructions) Inflate(client TwitterClient) TwitterS
 
 	if len(usernames) == 0 {
 		logger.Debug("All seed users already have IDs. No inflation necessary")
-		return seed
+		return seed, false
 	}
 
 	result, err := client.LookupUsers(usernames)
@@ -64,39 +109,326 @@ func (seed TwitterScrapeSeedInstructions) Inflate(client TwitterClient) TwitterS
 	idMap := make(map[string]string)
 
 	for _, user := range result.Data {
-		idMap[user.Username] = user.Id
+		idMap[strings.ToLower(user.Username)] = user.Id
 	}
 
 	var inflatedSeedUsers []TwitterScrapeSeedUser
+	changed := false
 
 	for _, user := range seed.Users {
 		newUser := user
 		if newUser.Id == nil {
-			value, isPresent := idMap[user.Username]
+			value, isPresent := idMap[strings.ToLower(user.Username)]
 
 			if isPresent {
 				newUser.Id = &value
+				changed = true
+			} else {
+				logger.Warn("Could not find a Twitter account for seed user %s", user.Username)
 			}
 		}
 
 		inflatedSeedUsers = append(inflatedSeedUsers, newUser)
 	}
 
-	return TwitterScrapeSeedInstructions{inflatedSeedUsers}
+	seed.Users = inflatedSeedUsers
+	return seed, changed
+}
+
+// Enabled seed users with an id who didn't contribute a single account to the pool,
+// usually because the id no longer resolves
+func (seed TwitterScrapeSeedInstructions) Missing(provenance SeedProvenance) []string {
+	counts := provenance.FollowCounts()
+	usernames := []string{}
+
+	for _, user := range seed.Users {
+		if user.Enabled && user.Id != nil && counts[user.Username] == 0 {
+			usernames = append(usernames, user.Username)
+		}
+	}
+
+	return usernames
+}
+
+// Look the given seed users up by username again and replace ids that no longer
+// match. Reports whether any id changed, so callers know to reload the pool.
+func (seed TwitterScrapeSeedInstructions) Reinflate(client TwitterClient, usernames []string) (TwitterScrapeSeedInstructions, bool) {
+	if len(usernames) == 0 {
+		return seed, false
+	}
+
+	result, err := client.LookupUsers(usernames)
+	check(err)
+
+	idMap := make(map[string]string)
+	for _, user := range result.Data {
+		idMap[strings.ToLower(user.Username)] = user.Id
+	}
+
+	var reinflatedSeedUsers []TwitterScrapeSeedUser
+	changed := false
+
+	for _, user := range seed.Users {
+		newUser := user
+
+		if user.Id != nil && containsString(usernames, user.Username) {
+			id, isPresent := idMap[strings.ToLower(user.Username)]
+
+			switch {
+			case !isPresent:
+				logger.Warn("Seed user %s (id %s) no longer resolves and added nobody to the pool. Run `flex_eth seed refresh` to check for a rename", user.Username, *user.Id)
+			case id != *user.Id:
+				logger.Warn("Seed user %s added nobody to the pool with stale id %s. Using its current id %s", user.Username, *user.Id, id)
+				newUser.Id = &id
+				changed = true
+			default:
+				logger.Warn("Seed user %s added nobody to the pool", user.Username)
+			}
+		}
+
+		reinflatedSeedUsers = append(reinflatedSeedUsers, newUser)
+	}
+
+	seed.Users = reinflatedSeedUsers
+	return seed, changed
+}
+
+// Re-check every seed user against Twitter. Usernames that no longer resolve are
+// looked up by their stored id in case the account was renamed, and ids that no
+// longer match their username are replaced.
+func (seed TwitterScrapeSeedInstructions) Refresh(client TwitterClient) (TwitterScrapeSeedInstructions, bool) {
+	usernames := []string{}
+
+	for _, user := range seed.Users {
+		usernames = append(usernames, user.Username)
+	}
+
+	if len(usernames) == 0 {
+		return seed, false
+	}
+
+	byUsername, err := client.LookupUsers(usernames)
+	check(err)
+
+	idMap := make(map[string]string)
+	for _, user := range byUsername.Data {
+		idMap[strings.ToLower(user.Username)] = user.Id
+	}
+
+	staleIds := []string{}
+	for _, user := range seed.Users {
+		_, isPresent := idMap[strings.ToLower(user.Username)]
+
+		if !isPresent && user.Id != nil {
+			staleIds = append(staleIds, *user.Id)
+		}
+	}
+
+	usernameMap := make(map[string]string)
+	if len(staleIds) > 0 {
+		byId, err := client.LookupUserIds(staleIds)
+		check(err)
+
+		for _, user := range byId.Data {
+			usernameMap[user.Id] = user.Username
+		}
+	}
+
+	var refreshedSeedUsers []TwitterScrapeSeedUser
+	changed := false
+
+	for _, user := range seed.Users {
+		newUser := user
+
+		if id, isPresent := idMap[strings.ToLower(user.Username)]; isPresent {
+			if user.Id == nil || *user.Id != id {
+				logger.Info("Updated id for seed user %s to %s", user.Username, id)
+				newUser.Id = &id
+				changed = true
+			}
+		} else if user.Id != nil {
+			if username, isPresent := usernameMap[*user.Id]; isPresent {
+				logger.Info("Seed user %s was renamed to %s", user.Username, username)
+				newUser.Username = username
+			} else {
+				logger.Warn("Seed user %s (id %s) no longer exists. Clearing the stale id", user.Username, *user.Id)
+				newUser.Id = nil
+			}
+
+			changed = true
+		} else {
+			logger.Warn("Could not find a Twitter account for seed user %s", user.Username)
+		}
+
+		refreshedSeedUsers = append(refreshedSeedUsers, newUser)
+	}
+
+	seed.Users = refreshedSeedUsers
+	return seed, changed
+}
+
+func (seed TwitterScrapeSeedInstructions) Find(username string) (int, bool) {
+	for index, user := range seed.Users {
+		if strings.EqualFold(user.Username, username) {
+			return index, true
+		}
+	}
+
+	return -1, false
+}
+
+func (seed TwitterScrapeSeedInstructions) Add(user TwitterScrapeSeedUser) (TwitterScrapeSeedInstructions, error) {
+	if _, isPresent := seed.Find(user.Username); isPresent {
+		return seed, fmt.Errorf("%s is already a seed user", user.Username)
+	}
+
+	seed.Users = append(append([]TwitterScrapeSeedUser{}, seed.Users...), user)
+
+	return seed, nil
 }
 
-func (seed TwitterScrapeSeedInstructions) Persist() {
+func (seed TwitterScrapeSeedInstructions) Remove(username string) (TwitterScrapeSeedInstructions, error) {
+	index, isPresent := seed.Find(username)
+	if !isPresent {
+		return seed, fmt.Errorf("%s is not a seed user", username)
+	}
+
+	seed.Users = append(append([]TwitterScrapeSeedUser{}, seed.Users[:index]...), seed.Users[index+1:]...)
+
+	return seed, nil
+}
+
+func (seed TwitterScrapeSeedInstructions) SetEnabled(username string, enabled bool) (TwitterScrapeSeedInstructions, error) {
+	index, isPresent := seed.Find(username)
+	if !isPresent {
+		return seed, fmt.Errorf("%s is not a seed user", username)
+	}
+
+	seed.Users = append([]TwitterScrapeSeedUser{}, seed.Users...)
+	seed.Users[index].Enabled = enabled
+
+	return seed, nil
+}
+
+func (seed TwitterScrapeSeedInstructions) SetSources(username string, sources []SeedSource) (TwitterScrapeSeedInstructions, error) {
+	index, isPresent := seed.Find(username)
+	if !isPresent {
+		return seed, fmt.Errorf("%s is not a seed user", username)
+	}
+
+	for _, source := range sources {
+		if source != FollowingSource && source != FollowersSource {
+			return seed, fmt.Errorf("unknown source %q (expected following or followers)", source)
+		}
+	}
+
+	seed.Users = append([]TwitterScrapeSeedUser{}, seed.Users...)
+	seed.Users[index].Sources = sources
+
+	return seed, nil
+}
+
+func (seed TwitterScrapeSeedInstructions) AddList(list TwitterScrapeSeedList) (TwitterScrapeSeedInstructions, error) {
+	for _, existing := range seed.Lists {
+		if existing.Id == list.Id {
+			return seed, fmt.Errorf("list %s is already a seed", list.Id)
+		}
+	}
+
+	seed.Lists = append(append([]TwitterScrapeSeedList{}, seed.Lists...), list)
+
+	return seed, nil
+}
+
+func (seed TwitterScrapeSeedInstructions) RemoveList(listId string) (TwitterScrapeSeedInstructions, error) {
+	lists := []TwitterScrapeSeedList{}
+
+	for _, list := range seed.Lists {
+		if list.Id != listId {
+			lists = append(lists, list)
+		}
+	}
+
+	if len(lists) == len(seed.Lists) {
+		return seed, fmt.Errorf("list %s is not a seed", listId)
+	}
+
+	seed.Lists = lists
+
+	return seed, nil
+}
+
+func (seed TwitterScrapeSeedInstructions) Include(username string) (TwitterScrapeSeedInstructions, error) {
+	for _, existing := range seed.Usernames {
+		if strings.EqualFold(existing, username) {
+			return seed, fmt.Errorf("%s is already included", username)
+		}
+	}
+
+	seed.Usernames = append(append([]string{}, seed.Usernames...), username)
+
+	return seed, nil
+}
+
+func (seed TwitterScrapeSeedInstructions) Exclude(username string) (TwitterScrapeSeedInstructions, error) {
+	usernames := []string{}
+
+	for _, existing := range seed.Usernames {
+		if !strings.EqualFold(existing, username) {
+			usernames = append(usernames, existing)
+		}
+	}
+
+	if len(usernames) == len(seed.Usernames) {
+		return seed, fmt.Errorf("%s is not included", username)
+	}
+
+	seed.Usernames = usernames
+
+	return seed, nil
+}
+
+func (seed TwitterScrapeSeedInstructions) Persist(path string) {
 	serializedSeed, err := json.MarshalIndent(seed, "", "  ")
 	check(err)
 
-	err = ioutil.WriteFile(SeedFile, serializedSeed, 0644)
+	err = ioutil.WriteFile(path, serializedSeed, 0644)
 	check(err)
 }
 
-func (seed TwitterScrapeSeedInstructions) LoadFollowing(client TwitterClient) []TwitterUser {
-	var following []TwitterUser
+// Which seeds led us to each account in the pool, keyed by Twitter user id. Seed
+// users are identified by username, lists by "list:<name>", and accounts added
+// directly by ExplicitUsernamesLabel.
+type SeedProvenance map[string][]string
 
-	requestCache := NewFileSystemCache("data")
+// How many accounts each seed contributed to the pool (before deduping)
+func (provenance SeedProvenance) FollowCounts() map[string]int {
+	counts := make(map[string]int)
+
+	for _, seedLabels := range provenance {
+		for _, seedLabel := range seedLabels {
+			counts[seedLabel]++
+		}
+	}
+
+	return counts
+}
+
+// Gather every account the seed file points at: who each seed user follows (or is
+// followed by), members of seed lists, and explicitly included usernames.
+func (seed TwitterScrapeSeedInstructions) LoadUserPool(client TwitterClient, requestCache Cache) ([]TwitterUser, SeedProvenance, error) {
+	var pool []TwitterUser
+	provenance := make(SeedProvenance)
+
+	addUsers := func(label string, users []TwitterUser) {
+		pool = append(pool, users...)
+
+		for _, user := range users {
+			if !containsString(provenance[user.Id], label) {
+				provenance[user.Id] = append(provenance[user.Id], label)
+			}
+		}
+	}
 
 	for _, user := range seed.Users {
 		if !user.Enabled {
@@ -104,24 +436,74 @@ func (seed TwitterScrapeSeedInstructions) LoadFollowing(client TwitterClient) []
 			continue
 		}
 
-		logger.Debug("Fetching following list for %s\n", user.Username)
+		if user.Id == nil {
+			logger.Warn("Seed user %s has no id. Skipping!\n", user.Username)
+			continue
+		}
 
-		userFollowing := client.ListAllFollowing(*user.Id, requestCache)
+		for _, source := range user.sources() {
+			endpoint := FollowingEndpoint(*user.Id)
+			if source == FollowersSource {
+				endpoint = FollowersEndpoint(*user.Id)
+			}
+
+			logger.Debug("Fetching %s list for %s\n", source, user.Username)
+
+			users, err := client.ListAllUsers(endpoint, requestCache)
+			if err != nil {
+				return nil, nil, fmt.Errorf("could not fetch the %s list of %s: %w", source, user.Username, err)
+			}
+
+			logger.Debug("Fetched %s list of %d users via %s\n", source, len(users), user.Username)
+
+			addUsers(user.Username, users)
+		}
+	}
+
+	for _, list := range seed.Lists {
+		if !list.Enabled {
+			logger.Debug("Seed list %s is disabled. Skipping!\n", list.label())
+			continue
+		}
 
-		logger.Debug("Fetched following list of %d users via %s\n", len(userFollowing), user.Username)
+		members, err := client.ListAllUsers(ListMembersEndpoint(list.Id), requestCache)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not fetch the members of %s: %w", list.label(), err)
+		}
+
+		logger.Debug("Fetched %d members of %s\n", len(members), list.label())
+
+		addUsers(list.label(), members)
+	}
+
+	if len(seed.Usernames) > 0 {
+		profiles, err := client.CachedLookupProfiles(seed.Usernames, requestCache)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not look up the seed usernames: %w", err)
+		}
 
-		following = append(following, userFollowing...)
+		addUsers(ExplicitUsernamesLabel, profiles)
 	}
 
-	var uniqueFollowing []TwitterUser
+	var uniquePool []TwitterUser
 	seen := make(map[string]bool)
 
-	for _, user := range following {
+	for _, user := range pool {
 		if !seen[user.Id] {
 			seen[user.Id] = true
-			uniqueFollowing = append(uniqueFollowing, user)
+			uniquePool = append(uniquePool, user)
+		}
+	}
+
+	return uniquePool, provenance, nil
+}
+
+func containsString(values []string, target string) bool {
+	for _, value := range values {
+		if value == target {
+			return true
 		}
 	}
 
-	return uniqueFollowing
+	return false
 }
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+)
+
+type Alert struct {
+	Rule      string    `json:"rule"`
+	Run       string    `json:"run"`
+	Timestamp time.Time `json:"timestamp"`
+	Message   string    `json:"message"`
+}
+
+// Alert rules look at the diff between the previous run and the latest one and
+// decide what is worth telling someone about.
+type AlertRule interface {
+	Evaluate(diff RunDiff, latest RunSnapshot) []Alert
+}
+
+type BalanceMoveRule struct {
+	threshold *big.Int // In wei
+}
+
+func (rule BalanceMoveRule) Evaluate(diff RunDiff, latest RunSnapshot) []Alert {
+	alerts := []Alert{}
+
+	for _, move := range diff.Movers {
+		if new(big.Int).Abs(move.change).Cmp(rule.threshold) < 0 {
+			continue
+		}
+
+		sign := ""
+		if move.change.Sign() > 0 {
+			sign = "+"
+		}
+
+		message := fmt.Sprintf(
+			"@%s balance moved %s%s ETH (%s -> %s)",
+			move.Username, sign, displayETH(move.change, 2), displayETH(move.before, 2), displayETH(move.after, 2),
+		)
+		alerts = append(alerts, Alert{"balance_move", latest.Id, latest.Timestamp, message})
+	}
+
+	return alerts
+}
+
+type AddressChangeRule struct{}
+
+func (rule AddressChangeRule) Evaluate(diff RunDiff, latest RunSnapshot) []Alert {
+	alerts := []Alert{}
+
+	for _, change := range diff.ResolutionChanges {
+		if change.Kind != AddressChanged {
+			continue
+		}
+
+		message := fmt.Sprintf("%s now resolves to %s (was %s)", change.Domain, displayAddress(change.After), displayAddress(change.Before))
+		alerts = append(alerts, Alert{"address_change", latest.Id, latest.Timestamp, message})
+	}
+
+	return alerts
+}
+
+type EnteredTopRule struct {
+	top int
+}
+
+func (rule EnteredTopRule) Evaluate(diff RunDiff, latest RunSnapshot) []Alert {
+	alerts := []Alert{}
+
+	for _, change := range diff.RankChanges {
+		if change.After == nil || *change.After > rule.top {
+			continue
+		}
+
+		if change.Before != nil && *change.Before <= rule.top {
+			continue
+		}
+
+		message := fmt.Sprintf("@%s entered the top %d at %s (was %s)", change.Username, rule.top, displayRank(change.After), displayRank(change.Before))
+		alerts = append(alerts, Alert{"entered_top", latest.Id, latest.Timestamp, message})
+	}
+
+	return alerts
+}
+
+// Alert sinks deliver alerts somewhere a human will see them
+
+type AlertSink interface {
+	Emit(alert Alert) error
+}
+
+type StdoutAlertSink struct{}
+
+func (sink StdoutAlertSink) Emit(alert Alert) error {
+	fmt.Printf("[%s] %s: %s\n", alert.Timestamp.Format(time.RFC3339), alert.Rule, alert.Message)
+	return nil
+}
+
+// Appends one JSON object per line so the file can be tailed or fed to jq
+type FileAlertSink struct {
+	path string
+}
+
+func (sink FileAlertSink) Emit(alert Alert) error {
+	serialized, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(sink.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	_, err = file.Write(append(serialized, '\n'))
+	return err
+}
+
+type WebhookAlertSink struct {
+	url string
+}
+
+func (sink WebhookAlertSink) Emit(alert Alert) error {
+	return StrictPostJSON(sink.url, alert)
+}
+
+type Watcher struct {
+	app      App
+	store    RunStore
+	rules    []AlertRule
+	sinks    []AlertSink
+	interval time.Duration
+}
+
+// Re-run the resolve and balance stages forever. The user pool is loaded once
+// at startup, so only Infura and Etherscan are hit on each tick.
+func (watcher Watcher) Run() {
+	previous, err := watcher.store.Latest()
+	hasPrevious := err == nil
+
+	for {
+		latest, err := watcher.app.Uncached().BuildSnapshot()
+		if err != nil {
+			// Skip this round rather than stopping the watch on a flaky price feed
+			logger.Error("Run failed: %s", err)
+			time.Sleep(watcher.interval)
+			continue
+		}
+
+		// Alert only on stored runs, so the next round compares against the last
+		// run that made it into the history
+		if err := watcher.store.Save(latest); err != nil {
+			logger.Error("Could not store run %s: %s", latest.Id, err)
+			time.Sleep(watcher.interval)
+			continue
+		}
+
+		logger.Info("Stored run %s", latest.Id)
+
+		if hasPrevious {
+			watcher.evaluate(previous, latest)
+		}
+
+		previous = latest
+		hasPrevious = true
+
+		time.Sleep(watcher.interval)
+	}
+}
+
+func (watcher Watcher) evaluate(previous RunSnapshot, latest RunSnapshot) {
+	diff := DiffRuns(watcher.app.config, previous, latest)
+
+	for _, rule := range watcher.rules {
+		for _, alert := range rule.Evaluate(diff, latest) {
+			for _, sink := range watcher.sinks {
+				err := sink.Emit(alert)
+
+				if err != nil {
+					logger.Error("Failed to emit alert: %s", err)
+				}
+			}
+		}
+	}
+}
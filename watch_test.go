@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testHolding struct {
+	domain  ENSDomain
+	address ETHAddress // Empty for a name that doesn't resolve
+	wei     string
+}
+
+type testUser struct {
+	id       string
+	username string
+	holdings []testHolding
+}
+
+// Users must be listed richest first, the order runs are stored in
+func testSnapshot(id string, users ...testUser) RunSnapshot {
+	snapshot := RunSnapshot{Id: id, Timestamp: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC), ETHPrice: "2000"}
+
+	for _, user := range users {
+		domains := []SnapshotDomain{}
+
+		for _, holding := range user.holdings {
+			domain := SnapshotDomain{Domain: holding.domain}
+
+			if holding.address != "" {
+				address := holding.address
+				wei := holding.wei
+				domain.Valid = true
+				domain.Address = &address
+				domain.BalanceWei = &wei
+			}
+
+			domains = append(domains, domain)
+		}
+
+		snapshot.Users = append(snapshot.Users, SnapshotUser{User: TwitterUser{Id: user.id, Username: user.username}, Domains: domains})
+	}
+
+	return snapshot
+}
+
+const (
+	aliceAddress ETHAddress = "0x00000000000000000000000000000000000000a1"
+	bobAddress   ETHAddress = "0x00000000000000000000000000000000000000b0"
+	carolAddress ETHAddress = "0x00000000000000000000000000000000000000c0"
+)
+
+func alertMessages(alerts []Alert) []string {
+	messages := []string{}
+
+	for _, alert := range alerts {
+		messages = append(messages, alert.Message)
+	}
+
+	return messages
+}
+
+func TestAlertRules(t *testing.T) {
+	oneETH := "1000000000000000000"
+	tenETH := "10000000000000000000"
+	twentyETH := "20000000000000000000"
+
+	previous := testSnapshot(
+		"previous",
+		testUser{"1", "alice", []testHolding{{"alice.eth", aliceAddress, twentyETH}}},
+		testUser{"2", "bob", []testHolding{{"bob.eth", bobAddress, tenETH}}},
+		testUser{"3", "carol", []testHolding{{"carol.eth", carolAddress, oneETH}}},
+	)
+
+	latest := testSnapshot(
+		"latest",
+		testUser{"3", "carol", []testHolding{{"carol.eth", carolAddress, twentyETH}}},
+		testUser{"1", "alice", []testHolding{{"alice.eth", bobAddress, tenETH}}},
+		testUser{"2", "bob", []testHolding{{"bob.eth", "", ""}}},
+	)
+
+	tests := []struct {
+		name     string
+		rule     AlertRule
+		expected []string
+	}{
+		{
+			"balance moves at or above the threshold in either direction",
+			BalanceMoveRule{ethToWei(floatToDecimal(10))},
+			[]string{
+				"@carol balance moved +19.00 ETH (1.00 -> 20.00)",
+				"@alice balance moved -10.00 ETH (20.00 -> 10.00)",
+				"@bob balance moved -10.00 ETH (10.00 -> 0.00)",
+			},
+		},
+		{
+			"balance moves below the threshold are ignored",
+			BalanceMoveRule{ethToWei(floatToDecimal(50))},
+			[]string{},
+		},
+		{
+			"only address changes, not names that stopped resolving",
+			AddressChangeRule{},
+			[]string{"alice.eth now resolves to " + string(bobAddress) + " (was " + string(aliceAddress) + ")"},
+		},
+		{
+			"users entering the top N",
+			EnteredTopRule{1},
+			[]string{"@carol entered the top 1 at #1 (was #3)"},
+		},
+		{
+			"users already in the top N don't alert",
+			EnteredTopRule{3},
+			[]string{},
+		},
+	}
+
+	diff := DiffRuns(DefaultConfig(), previous, latest)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			alerts := test.rule.Evaluate(diff, latest)
+			messages := alertMessages(alerts)
+
+			if strings.Join(messages, "\n") != strings.Join(test.expected, "\n") {
+				t.Errorf("expected alerts %q, got %q", test.expected, messages)
+			}
+
+			for _, alert := range alerts {
+				if alert.Run != "latest" || !alert.Timestamp.Equal(latest.Timestamp) {
+					t.Errorf("alert %+v isn't attributed to the latest run", alert)
+				}
+			}
+		})
+	}
+}
+
+func TestWebhookAlertSink(t *testing.T) {
+	alert := Alert{"balance_move", "latest", time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC), "@alice balance moved +1.00 ETH"}
+
+	tests := []struct {
+		status  int
+		wantErr bool
+	}{
+		{http.StatusOK, false},
+		{http.StatusAccepted, false},
+		{http.StatusNoContent, false},
+		{http.StatusNotFound, true},
+		{http.StatusTooManyRequests, true},
+		{http.StatusInternalServerError, true},
+	}
+
+	for _, test := range tests {
+		t.Run(http.StatusText(test.status), func(t *testing.T) {
+			var received Alert
+
+			server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				if request.Method != http.MethodPost || request.Header.Get("Content-Type") != "application/json" {
+					t.Errorf("expected a JSON POST, got %s %s", request.Method, request.Header.Get("Content-Type"))
+				}
+
+				body, _ := io.ReadAll(request.Body)
+				if err := json.Unmarshal(body, &received); err != nil {
+					t.Errorf("webhook body isn't an alert: %s", err)
+				}
+
+				writer.WriteHeader(test.status)
+			}))
+			defer server.Close()
+
+			err := WebhookAlertSink{server.URL}.Emit(alert)
+
+			if received.Message != alert.Message || received.Rule != alert.Rule {
+				t.Errorf("expected %+v to be delivered, got %+v", alert, received)
+			}
+
+			if !test.wantErr {
+				if err != nil {
+					t.Errorf("expected no error, got %s", err)
+				}
+				return
+			}
+
+			var statusError HTTPStatusError
+			if !errors.As(err, &statusError) || statusError.StatusCode != test.status {
+				t.Errorf("expected an HTTPStatusError with status %d, got %v", test.status, err)
+			}
+		})
+	}
+}